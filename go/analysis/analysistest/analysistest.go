@@ -14,13 +14,19 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"testing"
 	"text/scanner"
+	"time"
 
+	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/internal/checker"
 	"golang.org/x/tools/go/packages"
@@ -31,12 +37,20 @@ import (
 	"golang.org/x/tools/txtar"
 )
 
+// TempDir is the directory in which WriteFiles and WriteModule create
+// their temporary directories. If it is empty, they use the default
+// directory for temporary files (see os.TempDir). A test may set it,
+// typically in TestMain, to keep test data on a faster or larger file
+// system. File names in error messages are relative to the temporary
+// directory, wherever it is.
+var TempDir string
+
 // WriteFiles is a helper function that creates a temporary directory
 // and populates it with a GOPATH-style project using filemap (which
 // maps file names to contents). On success it returns the name of the
 // directory and a cleanup function to delete it.
 func WriteFiles(filemap map[string]string) (dir string, cleanup func(), err error) {
-	gopath, err := ioutil.TempDir("", "analysistest")
+	gopath, err := ioutil.TempDir(TempDir, "analysistest")
 	if err != nil {
 		return "", nil, err
 	}
@@ -53,6 +67,200 @@ func WriteFiles(filemap map[string]string) (dir string, cleanup func(), err erro
 	return gopath, cleanup, nil
 }
 
+// WriteTxtar is like WriteFiles, but it takes the files of the project
+// from a txtar archive (see golang.org/x/tools/txtar), which holds a
+// whole multi-file fixture in one readable file:
+//
+//	Comment, ignored.
+//	-- a/a.go --
+//	package a
+//
+//	func f() { print() } // want "call of print"
+//	-- a/b.go --
+//	package a
+//
+// The comment section that precedes the first file is ignored.
+// It is an error for the archive to contain two files of the same name.
+func WriteTxtar(data []byte) (dir string, cleanup func(), err error) {
+	filemap := make(map[string]string)
+	for _, f := range txtar.Parse(data).Files {
+		if _, ok := filemap[f.Name]; ok {
+			return "", nil, fmt.Errorf("txtar archive contains file %s twice", f.Name)
+		}
+		filemap[f.Name] = string(f.Data)
+	}
+	return WriteFiles(filemap)
+}
+
+// WriteModule is like WriteFiles, but it populates the temporary
+// directory with a Go module named modpath rather than a GOPATH-style
+// project: file names in filemap are relative to the module root, and
+// a go.mod file is generated unless filemap provides one.
+//
+// Each entry in stubs maps the import path of a dependency to the
+// files of a local stub package for it. A stub is written to its own
+// module beneath the "stub" directory, and the generated go.mod
+// requires it and redirects it there with a replace directive, so
+// that analyzers of a heavyweight library API can be tested against
+// a minimal fake of that library without network access.
+//
+// The files of a nested module, beneath a directory of the module root
+// whose go.mod file filemap provides, have import paths derived from
+// the path of the nested module, not from their directories, as in a
+// real project that contains several modules: if filemap provides
+// "sub/go.mod" declaring 'module example.com/other', the package in
+// directory sub/x has import path example.com/other/x. The generated
+// go.mod requires each nested module, and redirects it to its
+// directory, so that the packages of the module can import it.
+func WriteModule(modpath string, filemap map[string]string, stubs map[string]map[string]string) (dir string, cleanup func(), err error) {
+	return writeModule(modpath, filemap, stubs, false)
+}
+
+// WriteVendoredModule is like WriteModule, but it writes each stub
+// package to the module's vendor directory, as if by 'go mod vendor',
+// rather than to a separate module, so that analyzers can be tested on
+// projects that vendor their dependencies. Run loads the packages of a
+// module that has a vendor directory with -mod=vendor.
+func WriteVendoredModule(modpath string, filemap map[string]string, stubs map[string]map[string]string) (dir string, cleanup func(), err error) {
+	return writeModule(modpath, filemap, stubs, true)
+}
+
+func writeModule(modpath string, filemap map[string]string, stubs map[string]map[string]string, vendor bool) (dir string, cleanup func(), err error) {
+	dir, err = ioutil.TempDir(TempDir, "analysistest")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	write := func(name, content string) error {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0777) // ignore error
+		return ioutil.WriteFile(filename, []byte(content), 0666)
+	}
+
+	var pkgpaths []string
+	for pkgpath := range stubs {
+		pkgpaths = append(pkgpaths, pkgpath)
+	}
+	sort.Strings(pkgpaths) // for determinism
+
+	gomod := fmt.Sprintf("module %s\n", modpath)
+	var modulesTxt string
+	for _, pkgpath := range pkgpaths {
+		stubdir := "stub/" + pkgpath
+		if vendor {
+			stubdir = "vendor/" + pkgpath
+			gomod += fmt.Sprintf("\nrequire %s v0.0.0\n", pkgpath)
+			modulesTxt += fmt.Sprintf("# %s v0.0.0\n## explicit\n%s\n", pkgpath, pkgpath)
+		} else {
+			gomod += fmt.Sprintf("\nrequire %s v0.0.0\n\nreplace %s => ./%s\n", pkgpath, pkgpath, stubdir)
+			if err := write(stubdir+"/go.mod", fmt.Sprintf("module %s\n", pkgpath)); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+		}
+		for name, content := range stubs[pkgpath] {
+			if err := write(stubdir+"/"+name, content); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+		}
+	}
+	// Each nested module in filemap declares the import path
+	// of its packages, independent of their directories.
+	var nested []string
+	for name := range filemap {
+		if path.Base(name) == "go.mod" && name != "go.mod" {
+			nested = append(nested, name)
+		}
+	}
+	sort.Strings(nested) // for determinism
+	for _, name := range nested {
+		nestedpath := modfile.ModulePath([]byte(filemap[name]))
+		if nestedpath == "" {
+			cleanup()
+			return "", nil, fmt.Errorf("%s does not declare a module path", name)
+		}
+		gomod += fmt.Sprintf("\nrequire %s v0.0.0\n\nreplace %s => ./%s\n", nestedpath, nestedpath, path.Dir(name))
+	}
+
+	if vendor {
+		if err := write("vendor/modules.txt", modulesTxt); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	if _, ok := filemap["go.mod"]; !ok {
+		if err := write("go.mod", gomod); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+
+	for name, content := range filemap {
+		if err := write(name, content); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// WriteWorkspace is like WriteModule, but it populates the temporary
+// directory with a Go workspace of several modules, so that analyzers
+// can be tested on code that spans modules. Each entry in modules maps
+// a module path to the files of the module, which is written to the
+// directory of the same name beneath the root, with a go.mod file
+// generated unless it provides one. A go.work file at the root uses
+// all the modules, and Run loads the packages of a directory that has
+// one in workspace mode, in which the modules may import each other's
+// packages without requiring them. Workspaces require Go 1.18 or
+// later; an older go command ignores the go.work file and fails to
+// resolve the imports between the modules.
+func WriteWorkspace(modules map[string]map[string]string) (dir string, cleanup func(), err error) {
+	dir, err = ioutil.TempDir(TempDir, "analysistest")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	write := func(name, content string) error {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0777) // ignore error
+		return ioutil.WriteFile(filename, []byte(content), 0666)
+	}
+
+	var paths []string
+	for path := range modules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths) // for determinism
+
+	gowork := "go 1.18\n\nuse (\n"
+	for _, path := range paths {
+		gowork += fmt.Sprintf("\t./%s\n", path)
+		filemap := modules[path]
+		if _, ok := filemap["go.mod"]; !ok {
+			filemap = map[string]string{"go.mod": fmt.Sprintf("module %s\n\ngo 1.18\n", path)}
+			for name, content := range modules[path] {
+				filemap[name] = content
+			}
+		}
+		for name, content := range filemap {
+			if err := write(path+"/"+name, content); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+		}
+	}
+	gowork += ")\n"
+	if err := write("go.work", gowork); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
 // TestData returns the effective filename of
 // the program's "testdata" directory.
 // This function may be overridden by projects using
@@ -66,6 +274,19 @@ var TestData = func() string {
 	return testdata
 }
 
+// ResolvePackage, if non-nil, is called by Run and related functions
+// to load the package denoted by each pattern, in place of go/packages,
+// which follows the conventions of the go command. It may be set by
+// projects using an alternative build system (such as Blaze) in which
+// patterns map to source files differently. The dir argument is the
+// directory given to Run. The package must be complete: it must have
+// syntax trees, with comments, and type information, and its imports
+// must be complete too if the analyzer uses facts. The options of a
+// Runner that affect loading, such as WithBuildTags and WithOverlay,
+// are the responsibility of the function. By default, ResolvePackage
+// is nil.
+var ResolvePackage func(dir, pattern string) (*packages.Package, error)
+
 // Testing is an abstraction of a *testing.T.
 type Testing interface {
 	Errorf(format string, args ...interface{})
@@ -98,8 +319,19 @@ type Testing interface {
 // 			println()
 // 		}
 // 	}
+//
+// RunWithSuggestedFixes also reports each edit of a suggested fix that
+// replaces text with identical text, as such spurious edits are a
+// common mistake, and each edit that starts before the preceding edit
+// of its fix, as the edits of a fix must be in source order.
 func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
-	r := Run(t, dir, a, patterns...)
+	return NewRunner().RunWithSuggestedFixes(t, dir, a, patterns...)
+}
+
+// RunWithSuggestedFixes behaves like the package-level
+// RunWithSuggestedFixes function, but uses the Runner's configuration.
+func (r *Runner) RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	results := r.Run(t, dir, a, patterns...)
 
 	// Process each result (package) separately, matching up the suggested
 	// fixes into a diff, which we will compare to the .golden file.  We have
@@ -111,14 +343,19 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 	// Validating the results separately means as long as the two analyses
 	// don't produce conflicting suggestions for a single file, everything
 	// should match up.
-	for _, act := range r {
+	compiled := make(map[fixedFile]bool)
+	for _, act := range results {
 		// file -> message -> edits
 		fileEdits := make(map[*token.File]map[string][]diff.TextEdit)
 		fileContents := make(map[*token.File][]byte)
 
+		// the contents of each file after applying its fixes
+		var fixed []fixedFile
+
 		// Validate edits, prepare the fileEdits map and read the file contents.
-		for _, diag := range act.Diagnostics {
+		for _, diag := range r.cfg.filter(act.Diagnostics) {
 			for _, sf := range diag.SuggestedFixes {
+				checkEditOrder(t, dir, act.Pass.Fset, sf)
 				for _, edit := range sf.TextEdits {
 					// Validate the edit.
 					if edit.Pos > edit.End {
@@ -141,6 +378,16 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 						}
 						fileContents[file] = contents
 					}
+					// Reject edits that do not change the file.
+					if contents := fileContents[file]; contents != nil {
+						start, end := file.Offset(edit.Pos), file.Offset(edit.End)
+						if bytes.Equal(contents[start:end], edit.NewText) {
+							posn := act.Pass.Fset.Position(edit.Pos)
+							posn.Filename = sanitize(dir, posn.Filename)
+							t.Errorf("%v: suggested fix %q contains a no-op edit, which replaces %q with identical text",
+								posn, sf.Message, edit.NewText)
+						}
+					}
 					spn, err := span.NewRange(act.Pass.Fset, edit.Pos, edit.End).Span()
 					if err != nil {
 						t.Errorf("error converting edit to span %s: %v", file.Name(), err)
@@ -189,6 +436,7 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 						if vf.Name == sf {
 							found = true
 							out := diff.ApplyEdits(string(orig), edits)
+							fixed = append(fixed, fixedFile{file.Name(), fmt.Sprintf("suggested fix %q", sf), out})
 							// the file may contain multiple trailing
 							// newlines if the user places empty lines
 							// between files in the archive. normalize
@@ -221,6 +469,7 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 				}
 
 				out := diff.ApplyEdits(string(orig), catchallEdits)
+				fixed = append(fixed, fixedFile{file.Name(), "suggested fixes", out})
 				want := string(ar.Comment)
 
 				formatted, err := format.Source([]byte(out))
@@ -236,24 +485,56 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 				}
 			}
 		}
+
+		if r.cfg.compileFixes {
+			for _, f := range fixed {
+				// A file may appear in more than one package.
+				if !compiled[f] {
+					compiled[f] = true
+					r.checkCompiles(t, dir, act.Package.PkgPath, f)
+				}
+			}
+		}
 	}
-	return r
+	return results
 }
 
 // Run applies an analysis to the packages denoted by the "go list" patterns.
 //
-// It loads the packages from the specified GOPATH-style project
-// directory using golang.org/x/tools/go/packages, runs the analysis on
+// It loads the packages from the specified directory using
+// golang.org/x/tools/go/packages, runs the analysis on
 // them, and checks that each analysis emits the expected diagnostics
 // and facts specified by the contents of '// want ...' comments in the
 // package's source files.
 //
+// If the directory contains a go.mod file, such as one created by
+// WriteModule, it is treated as the root of a module and the packages
+// are loaded in module mode. Otherwise it is treated as the root of a
+// GOPATH-style project tree, with packages beneath its src directory.
+// The dependencies of a module that has a vendor directory, such as one
+// created by WriteVendoredModule, are loaded from it. If the directory
+// contains a go.work file, such as one created by WriteWorkspace, it is
+// treated as the root of a workspace, and the packages are loaded in
+// workspace mode.
+//
+// The patterns are package patterns, as accepted by 'go list', such as
+// "a" or "a/...". Each is interpreted relative to the root: the import
+// path of a package is the path of its directory beneath dir/src, in
+// GOPATH mode, or the module path joined with the path of its directory
+// beneath dir, in module mode. The import path is unrelated to the name
+// of the package declared by its files, which need not match the last
+// element of its directory: a pattern "bar" denotes the package in
+// directory bar even if its files declare 'package foo'.
+//
 // An expectation of a Diagnostic is specified by a string literal
 // containing a regular expression that must match the diagnostic
 // message. For example:
 //
 //	fmt.Printf("%s", 1) // want `cannot provide int 1 to %s`
 //
+// The regular expression need only match part of the message, unless
+// the Runner is configured by WithAnchoredPatterns.
+//
 // An expectation of a Fact associated with an object is specified by
 // 'name:"pattern"', where name is the name of the object, which must be
 // declared on the same line as the comment, and pattern is a regular
@@ -265,48 +546,624 @@ func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns
 // Package facts are specified by the name "package" and appear on
 // line 1 of the first source file of the package.
 //
+// Expectations of diagnostics in non-Go files of the package, such as
+// assembly files, are specified by '// want ...' comments in those
+// files, in the same way. See WithNonGoFiles for files of other kinds.
+//
 // A single 'want' comment may contain a mixture of diagnostic and fact
 // expectations, including multiple facts about the same object:
 //
 //	// want "diag" "diag2" x:"fact1" x:"fact2" y:"fact3"
 //
+// A 'want' comment that begins with '~N' relaxes its diagnostic
+// expectations: each may be satisfied by a diagnostic up to N lines
+// before or after its line, the nearest first, which suits test data
+// whose lines shift, such as the output of a generator. A diagnostic
+// never satisfies a relaxed expectation if an expectation of its own
+// line matches it, nor does a relaxed expectation accept a diagnostic
+// of another line if a diagnostic of its own line matches it:
+//
+//	// want ~2 "call of print"
+//
+// An expectation of the form 'any:"pattern1" "pattern2"...' is a
+// single diagnostic expectation that is satisfied by a message matching
+// any of the alternative patterns, which is clearer than regular
+// expression alternation when, for example, a message varies across
+// Go versions. The alternatives are all the strings that follow, so it
+// must be the last diagnostic expectation of its comment:
+//
+//	x := y // want any:"unused variable" "declared but not used"
+//
+// An expectation of the form 'sprintf:"format" args...' is satisfied by
+// a message that equals, exactly, the result of formatting the args
+// with fmt.Sprintf. It is clearer than a regular expression for a
+// message that quotes an identifier. The args are all the identifiers,
+// which are formatted as strings, and numbers that follow:
+//
+//	var x int // want sprintf:"unused variable %q" x
+//
+// An expectation of the form 'prefix:"text"' is satisfied by a message
+// that starts with the text, which is literal, not a regular
+// expression, so it needs no escapes:
+//
+//	x := 1 // want prefix:"unused ("
+//
+// An expectation of the form 'code:"code"' is satisfied by a message
+// that has the code, a machine-readable tag that some analyzers embed
+// in their messages, such as "SA1000" in "[SA1000] invalid regular
+// expression". It makes a test independent of the wording of the rest
+// of the message. See WithCodePattern for the rule that extracts the
+// code:
+//
+//	regexp.MustCompile("(") // want code:"SA1000"
+//
+// An expectation of the form 'id:R1234', whose ID is unquoted, is
+// similar, but matches the stable rule ID of a linter whose rules are
+// cataloged, extracted from the message by the pattern given by
+// WithIDPattern, which has no default:
+//
+//	x := x // want id:R1234
+//
+// An expectation of the form 'compile-error "pattern"' is satisfied by
+// an error reported by the loader on its line, such as a parse or type
+// error, whose message matches the pattern. It allows a test of an
+// analyzer designed to run on ill-typed code to check that the errors
+// it must tolerate occur where intended; such an analyzer must set
+// RunDespiteErrors (see also WithRunDespiteErrors). Errors on lines
+// without such an expectation are not checked:
+//
+//	var x int = "s" // want compile-error "cannot use" "untyped string"
+//
+// An expectation of the form 'covers:"text" "pattern"' is satisfied by
+// a message matching the pattern, but is also an assertion that the
+// range of the diagnostic, from Pos to End, spans exactly the text,
+// which is literal. It checks, for example, that a diagnostic underlines
+// just the intended identifier in an editor. A diagnostic without an
+// End cannot satisfy the assertion:
+//
+//	x := 1 // want covers:"x" "unused variable"
+//
+// An expectation of the form 'infunc:"name" "pattern"' is satisfied by
+// a message matching the pattern, but is also an assertion that the
+// diagnostic lies within the body of the function declared in the
+// package with the name. A method is named by its receiver type and
+// its name, such as "T.f"; an unqualified name that more than one
+// function or method declares is an error:
+//
+//	return nil // want infunc:"T.Close" "error is discarded"
+//
+// The expectations 'ingenerated "pattern"' and 'innormal "pattern"'
+// are satisfied by a message matching the pattern, but are also
+// assertions that the file of the diagnostic is, or is not, generated:
+// that it has a comment of the form "// Code generated ... DO NOT EDIT."
+// before its package clause, by the convention of generated Go files.
+// They pin down the behavior of an analyzer that treats generated code
+// specially:
+//
+//	x := 1 // want ingenerated "unused variable"
+//
+// An expectation of the form 'import:"path" "pattern"' is satisfied by
+// a diagnostic on the line of the import spec of the file for the
+// package path, rather than on the line of the comment, whose message
+// matches the pattern. It anchors an expectation of an analyzer that
+// reports on imports without a comment within an import declaration:
+//
+//	package a // want import:"fmt" "fmt imported but not used"
+//
+// A diagnostic expectation may be followed by 'url:"url"', which
+// asserts that the diagnostic that satisfies it has the documentation
+// URL, which is literal. A diagnostic without a URL fails the
+// assertion:
+//
+//	x := 1 // want "unused variable" url:"https://example.com/unused"
+//
+// The expectation 'none' asserts that no diagnostic is reported on its
+// line, which documents the intent of a test of a suppression comment
+// such as '//nolint' or '//lint:ignore'. It may not be combined with
+// other expectations:
+//
+//	fmt.Printf("%s", 1) //nolint // want none
+//
+// The expectation 'last "pattern"' is satisfied by the last diagnostic
+// on its line, the one with the highest column, or, of those with the
+// same column, the last reported, whose message must match the pattern.
+// The other diagnostics on the line are matched by its other
+// expectations, if any, or else ignored. It checks one diagnostic of a
+// line on which an analyzer reports several that are not of interest:
+//
+//	f(g(h())) // want last "call of h"
+//
+// The expectation 'once "pattern"' is not tied to a line: it asserts
+// that exactly one diagnostic reported anywhere in the package matches
+// the pattern, which is useful for package-scoped findings that an
+// analyzer must report only once, however many files trigger them.
+// Diagnostics that match an expectation on their own line are not
+// counted.
+//
+//	// want once "package uses deprecated API"
+//
+// The expectations of a source file that cannot be annotated with
+// comments, such as a generated file, may instead be written in a
+// sidecar file, whose name is that of the source file with the suffix
+// ".want", such as foo.go.want for foo.go. Each non-blank line of a
+// sidecar file holds the expectations of one line of the source file,
+// in the form 'line: expectations', where the expectations have the
+// syntax of a 'want' comment. See WithSidecarUpdate.
+//
+//	4: "call of print"
+//
 // Unexpected diagnostics and facts, and unmatched expectations, are
-// reported as errors to the Testing.
+// reported as errors to the Testing. For each package with errors, a
+// summary of their numbers, and of the number of matched expectations,
+// is also logged, if the Testing has a Logf method. A diagnostic in a
+// file that does not belong to the package under analysis, such as a
+// file of an imported package or a file excluded from the build, is
+// also reported as an error, as is a diagnostic with an empty message
+// or a message that is not valid UTF-8.
 //
 // Run reports an error to the Testing if loading or analysis failed.
 // Run also returns a Result for each package for which analysis was
 // attempted, even if unsuccessful. It is safe for a test to ignore all
 // the results, but a test may use it to perform additional checks.
+// The packages of the Results share a single FileSet, so positions in
+// different packages may be compared.
 func Run(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	return NewRunner().Run(t, dir, a, patterns...)
+}
+
+// A Runner applies an analysis and checks its results in the manner of
+// Run, with additional behavior configured by Options.
+type Runner struct {
+	cfg config
+}
+
+// NewRunner returns a Runner configured by the given options.
+// A Runner with no options behaves exactly like Run.
+func NewRunner(opts ...Option) *Runner {
+	r := new(Runner)
+	for _, opt := range opts {
+		opt.set(&r.cfg)
+	}
+	return r
+}
+
+// Run behaves like the package-level Run function,
+// but uses the Runner's configuration.
+func (r *Runner) Run(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	return r.run(t, dir, func(*packages.Package) *analysis.Analyzer { return a }, patterns...)
+}
+
+// RunConstructor behaves like Run, but obtains the analyzer to apply
+// to each package by calling newAnalyzer, once per package, so that
+// each package is analyzed by a fresh instance. It is intended for
+// analyzers that are parameterized by a constructor function, or that
+// accumulate state, such as flag values, which must not be shared
+// between packages or tests.
+//
+// Since a fact is private to the analyzer instance that exports it,
+// the dependencies of each package are analyzed again by its instance.
+func RunConstructor(t Testing, dir string, newAnalyzer func() *analysis.Analyzer, patterns ...string) []*Result {
+	return NewRunner().RunConstructor(t, dir, newAnalyzer, patterns...)
+}
+
+// RunConstructor behaves like the package-level RunConstructor
+// function, but uses the Runner's configuration.
+func (r *Runner) RunConstructor(t Testing, dir string, newAnalyzer func() *analysis.Analyzer, patterns ...string) []*Result {
+	return r.run(t, dir, func(*packages.Package) *analysis.Analyzer { return newAnalyzer() }, patterns...)
+}
+
+// RunDir behaves like Run, but applies the analysis to the packages of
+// an existing directory, such as a corpus of real-world code checked in
+// to the repository, rather than one created by WriteFiles, which need
+// not be copied or cleaned up. The directory may be relative to the
+// current directory, and may be or contain a symbolic link, as it is
+// made absolute and resolved before loading, so that the file names in
+// errors are relative to it as usual. It must be the root of a
+// GOPATH-style tree, a module, or a workspace.
+//
+// For a test to be hermetic, the directory must be self-contained:
+// packages are loaded with GOPROXY=off, so every dependency outside the
+// standard library must be within it, for example in a vendor directory
+// or in another module of a workspace.
+func RunDir(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	return NewRunner().RunDir(t, dir, a, patterns...)
+}
+
+// RunDir behaves like the package-level RunDir function,
+// but uses the Runner's configuration.
+func (r *Runner) RunDir(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	root, err := existingRoot(dir)
+	if err != nil {
+		t.Errorf("%v", err)
+		return nil
+	}
+	return r.Run(t, root, a, patterns...)
+}
+
+// existingRoot returns the absolute name of the directory dir, with
+// symbolic links resolved, or an error if it is not the root of a
+// GOPATH-style tree, a module, or a workspace.
+func existingRoot(dir string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	for _, name := range []string{"go.work", "go.mod", "src"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not the root of a GOPATH-style tree, a module, or a workspace", dir)
+}
+
+// run loads the packages matching patterns in dir, applies to each the
+// analyzer returned for it by analyzerFor, and checks the results.
+func (r *Runner) run(t Testing, dir string, analyzerFor func(*packages.Package) *analysis.Analyzer, patterns ...string) []*Result {
 	if t, ok := t.(testenv.Testing); ok {
 		testenv.NeedsGoPackages(t)
 	}
 
-	pkgs, err := loadPackages(dir, patterns...)
+	t0 := time.Now()
+	pkgs, err := r.loadPackages(t, dir, patterns...)
 	if err != nil {
 		t.Errorf("loading %s: %v", patterns, err)
 		return nil
 	}
+	loadTime := time.Since(t0)
 
-	results := checker.TestAnalyzer(a, pkgs)
-	for _, result := range results {
-		if result.Err != nil {
-			t.Errorf("error analyzing %s: %v", result.Pass, result.Err)
-		} else {
-			check(t, dir, result.Pass, result.Diagnostics, result.Facts)
+	if r.cfg.wantPackages > 0 && len(pkgs) != r.cfg.wantPackages {
+		var ids []string
+		for _, pkg := range pkgs {
+			ids = append(ids, pkg.ID)
+		}
+		t.Errorf("loading %s: got %d packages %q, want %d", patterns, len(pkgs), ids, r.cfg.wantPackages)
+	}
+
+	if r.cfg.coverage != nil {
+		r.cfg.coverage.reset(dir)
+	}
+
+	// Group the packages by analyzer, in order of first appearance,
+	// so that each analyzer is applied to all of its packages at once.
+	var analyzers []*analysis.Analyzer
+	groups := make(map[*analysis.Analyzer][]*packages.Package)
+	for _, pkg := range pkgs {
+		a := analyzerFor(pkg)
+		if groups[a] == nil {
+			analyzers = append(analyzers, a)
+		}
+		groups[a] = append(groups[a], pkg)
+	}
+
+	var (
+		results     []*Result
+		analyzeTime time.Duration
+		warned      bool
+	)
+	// Analyze all the groups before checking
+	// the results, so that a profile covers
+	// just the analyses.
+	stop := startProfiling(t, r.cfg.cpuProfile, r.cfg.memProfile)
+	allocated := measureAlloc()
+	resultsOf := make(map[*analysis.Analyzer][]*Result)
+	disabled := make(map[*analysis.Analyzer]map[string]bool) // see WithEnabledChecks
+	if r.cfg.enabledChecks != nil {
+		for _, a := range analyzers {
+			d, restore, err := enableChecks(a, r.cfg.enabledChecks)
+			if err != nil {
+				t.Errorf("%v", err)
+				return nil
+			}
+			defer restore()
+			disabled[a] = d
+		}
+	}
+	for _, a := range analyzers {
+		if r.cfg.syntaxOnly && needFacts(a) && !warned {
+			logf(t, "warning: analyzer %s uses facts, which require type information, but the Runner loads only syntax", a)
+			warned = true
+		}
+
+		t0 = time.Now()
+		resultsOf[a] = r.testAnalyzer(t, dir, a, groups[a])
+		analyzeTime += time.Since(t0)
+	}
+	if n := allocated(); r.cfg.maxAlloc > 0 && n > r.cfg.maxAlloc {
+		t.Errorf("analysis of %s allocated %d bytes, more than the limit of %d set by WithMaxAlloc", patterns, n, r.cfg.maxAlloc)
+	}
+	stop()
+
+	var cases []*testCase // for a CI report
+	for _, a := range analyzers {
+		res := resultsOf[a]
+		if r.cfg.stress > 0 {
+			r.checkStress(t, dir, a, groups[a], res)
+		}
+
+		for _, result := range res {
+			t := t
+			if r.cfg.tapReport != nil || r.cfg.junitReport != nil {
+				tc := &testCase{Testing: t, analyzer: a.Name, pkg: result.Package.ID}
+				cases = append(cases, tc)
+				t = tc
+			}
+			if result.Err != nil && r.cfg.syntaxOnly {
+				t.Errorf("error analyzing %s@%s: %v (with WithSyntaxOnly, the analyzer must not use type information)", a, result.Package.ID, result.Err)
+			} else if result.Err != nil {
+				t.Errorf("error analyzing %s: %v", result.Pass, result.Err)
+			} else {
+				diagnostics := r.cfg.filter(result.Diagnostics)
+				if r.cfg.exportedOnly {
+					diagnostics = exportedOnly(result.Pass, diagnostics)
+				}
+				if r.cfg.maxFindings > 0 && len(diagnostics) > r.cfg.maxFindings {
+					reportRunaway(t, dir, result, diagnostics, r.cfg.maxFindings)
+					continue
+				}
+				if r.cfg.roundTripJSON {
+					diagnostics = roundTripJSON(t, dir, result.Pass, result.Package.ID, diagnostics)
+				}
+				checked := diagnostics
+				if r.cfg.jsonGolden {
+					checked = nil // see checkJSONGolden
+				}
+				check(t, &r.cfg, dir, result.Pass, checked, result.Facts, result.Package.Errors)
+				if d := disabled[a]; d != nil {
+					checkDisabled(t, dir, result.Pass, diagnostics, d)
+				}
+				if r.cfg.coverage != nil {
+					r.cfg.coverage.report(result.Pass, diagnostics)
+				}
+			}
 		}
+		results = append(results, res...)
+	}
+
+	if r.cfg.report {
+		checkReport(t, r.cfg.updateReport, dir, results, r.cfg.filter)
+	}
+	if r.cfg.jsonGolden {
+		checkJSONGolden(t, r.cfg.updateJSON, dir, results, r.cfg.filter)
+	}
+	if r.cfg.resultGolden {
+		checkResultGolden(t, r.cfg.updateResult, dir, results, r.cfg.formatResult)
+	}
+
+	if r.cfg.snapshot != nil {
+		writeSnapshot(t, r.cfg.snapshot, dir, results, r.cfg.filter)
+	}
+	if r.cfg.snapshotFile != "" {
+		checkSnapshotFile(t, r.cfg.updateSnapshot, r.cfg.snapshotFile, dir, results, r.cfg.filter)
+	}
+
+	if r.cfg.timing {
+		reportTiming(t, loadTime, analyzeTime, results)
+	}
+
+	if r.cfg.tapReport != nil {
+		writeTAP(t, r.cfg.tapReport, cases)
+	}
+	if r.cfg.junitReport != nil {
+		writeJUnit(t, r.cfg.junitReport, cases)
 	}
 	return results
 }
 
+// testAnalyzer applies the analyzer to the packages in dir, reporting
+// to t any error in the facts supplied by WithImportedFact, any fact
+// exported twice if WithNoDuplicateFacts is set, and any analysis that
+// does not finish within the timeout of WithTimeout, in which case it
+// returns no results.
+func (r *Runner) testAnalyzer(t Testing, dir string, a *analysis.Analyzer, pkgs []*packages.Package) (results []*Result) {
+	opts := &checker.TestOptions{
+		RunDespiteErrors: r.cfg.despiteErrors != nil && *r.cfg.despiteErrors,
+		RecoverPanics:    r.cfg.syntaxOnly || r.cfg.stress > 0, // e.g. a use of the nil TypesInfo
+		MaxParallel:      r.cfg.maxParallel,
+	}
+	if opts.MaxParallel <= 0 {
+		opts.MaxParallel = runtime.GOMAXPROCS(0)
+	}
+	if r.cfg.nodeBudget > 0 {
+		visits := new(nodeVisits)
+		opts.Traverse = visits.record
+		defer func() { visits.checkBudget(t, r.cfg.nodeBudget, results) }()
+	}
+	if r.cfg.noDupFacts {
+		exports := new(factExports)
+		opts.ExportFact = exports.record
+		defer func() { exports.checkDuplicates(t, dir, results) }()
+	}
+	if r.cfg.facts != nil {
+		opts.ImportFacts = func(a2 *analysis.Analyzer, pkg *types.Package) ([]analysis.ObjectFact, []analysis.PackageFact, bool) {
+			facts, ok := r.cfg.facts[pkg.Path()]
+			if a2 != a || !ok {
+				return nil, nil, false
+			}
+			var objectFacts []analysis.ObjectFact
+			var packageFacts []analysis.PackageFact
+			for _, f := range facts {
+				if f.name == "" {
+					packageFacts = append(packageFacts, analysis.PackageFact{Package: pkg, Fact: f.fact})
+				} else if obj := pkg.Scope().Lookup(f.name); obj != nil {
+					objectFacts = append(objectFacts, analysis.ObjectFact{Object: obj, Fact: f.fact})
+				} else {
+					t.Errorf("package %s has no object %s for imported %T fact", pkg.Path(), f.name, f.fact)
+				}
+			}
+			return objectFacts, packageFacts, true
+		}
+	}
+	analyze := func() []*Result { return checker.TestAnalyzerWithOptions(a, pkgs, opts) }
+	if r.cfg.checker != nil {
+		analyze = func() []*Result { return r.cfg.checker(a, pkgs) }
+	}
+	if r.cfg.timeout <= 0 {
+		return analyze()
+	}
+
+	// Keep track of the packages being analyzed,
+	// to report those that do not finish in time.
+	var mu sync.Mutex
+	running := make(map[string]bool)
+	opts.Trace = func(a *analysis.Analyzer, pkg *packages.Package) func() {
+		key := fmt.Sprintf("%s@%s", a, pkg.ID)
+		mu.Lock()
+		running[key] = true
+		mu.Unlock()
+		return func() {
+			mu.Lock()
+			delete(running, key)
+			mu.Unlock()
+		}
+	}
+	done := make(chan []*Result, 1)
+	go func() { done <- analyze() }()
+	select {
+	case res := <-done:
+		return res
+	case <-time.After(r.cfg.timeout):
+		mu.Lock()
+		var keys []string
+		for key := range running {
+			keys = append(keys, key)
+		}
+		mu.Unlock()
+		sort.Strings(keys)
+		t.Errorf("analysis did not finish within %v; still running: %s", r.cfg.timeout, strings.Join(keys, ", "))
+		return nil
+	}
+}
+
+// A fixedFile holds the contents of a file
+// after applying one or more suggested fixes.
+type fixedFile struct {
+	filename string
+	fixes    string // description of the fixes
+	content  string
+}
+
+// checkCompiles reloads the package pkgpath, replacing the file fixed
+// by its fixed contents, and reports any resulting errors to t.
+func (r *Runner) checkCompiles(t Testing, dir, pkgpath string, f fixedFile) {
+	r2 := &Runner{cfg: r.cfg}
+	r2.cfg.despiteErrors = nil
+	WithOverlay(map[string]string{sanitize(dir, f.filename): f.content}).set(&r2.cfg)
+	pkgs, err := r2.loadPackages(t, dir, pkgpath)
+	if err != nil {
+		t.Errorf("loading %s after applying %s to %s: %v", pkgpath, f.fixes, sanitize(dir, f.filename), err)
+		return
+	}
+	var errs []string
+	seen := make(map[string]bool)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			msg := sanitize(dir, err.Pos) + ": " + err.Msg
+			if !seen[msg] {
+				seen[msg] = true
+				errs = append(errs, msg)
+			}
+		}
+	})
+	if errs != nil {
+		t.Errorf("%s: applying %s produces code that does not compile:\n\t%s", sanitize(dir, f.filename), f.fixes, strings.Join(errs, "\n\t"))
+	}
+}
+
+// RunMatrix applies an analysis to the package pkg in dir once for
+// each set of build tags in tagSets, in a subtest named after the tags,
+// and checks the expectations of each run as Run does. Since the
+// files of the package are selected by their build constraints, each
+// set of tags may have different expectations, which allows one test
+// fixture to cover the behavior of an analyzer across platforms or
+// build modes. An empty set of tags is named "notags".
+func RunMatrix(t *testing.T, dir string, a *analysis.Analyzer, pkg string, tagSets [][]string) {
+	NewRunner().RunMatrix(t, dir, a, pkg, tagSets)
+}
+
+// RunMatrix behaves like the package-level RunMatrix function, but uses
+// the Runner's configuration, except for its build tags.
+func (r *Runner) RunMatrix(t *testing.T, dir string, a *analysis.Analyzer, pkg string, tagSets [][]string) {
+	for _, tags := range tagSets {
+		tags := tags
+		name := strings.Join(tags, ",")
+		if name == "" {
+			name = "notags"
+		}
+		t.Run(name, func(t *testing.T) {
+			r2 := &Runner{cfg: r.cfg}
+			r2.cfg.buildTags = tags
+			r2.Run(t, dir, a, pkg)
+		})
+	}
+}
+
+// RunPlatforms applies an analysis to the package pkg in dir once for
+// each target platform in platforms, in the form "goos/goarch", such as
+// "windows/amd64", in a subtest named after the platform, and checks the
+// expectations of each run as Run does. The package is loaded as if
+// GOOS and GOARCH were set to those of the platform, whatever the host,
+// so its files are selected by their file names and build constraints
+// for that platform: a fixture may provide a stub file for each
+// platform, such as api_windows.go and api_linux.go, and only the
+// 'want' comments of the files for the target platform are checked.
+// This allows one fixture to test an analyzer of the cross-platform use
+// of an API.
+func RunPlatforms(t *testing.T, dir string, a *analysis.Analyzer, pkg string, platforms []string) {
+	NewRunner().RunPlatforms(t, dir, a, pkg, platforms)
+}
+
+// RunPlatforms behaves like the package-level RunPlatforms function,
+// but uses the Runner's configuration, except for its target platform.
+func (r *Runner) RunPlatforms(t *testing.T, dir string, a *analysis.Analyzer, pkg string, platforms []string) {
+	for _, platform := range platforms {
+		i := strings.Index(platform, "/")
+		if i < 0 {
+			t.Errorf("invalid platform %q, want goos/goarch", platform)
+			continue
+		}
+		goos, goarch := platform[:i], platform[i+1:]
+		t.Run(goos+"_"+goarch, func(t *testing.T) {
+			r2 := &Runner{cfg: r.cfg}
+			r2.cfg.goos, r2.cfg.goarch = goos, goarch
+			r2.Run(t, dir, a, pkg)
+		})
+	}
+}
+
+// needFacts reports whether a or any analyzer it requires uses facts.
+func needFacts(a *analysis.Analyzer) bool {
+	if len(a.FactTypes) > 0 {
+		return true
+	}
+	for _, req := range a.Requires {
+		if needFacts(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// logf logs a message to t, if it supports logging.
+func logf(t Testing, format string, args ...interface{}) {
+	if t, ok := t.(interface {
+		Logf(format string, args ...interface{})
+	}); ok {
+		t.Logf(format, args...)
+	}
+}
+
 // A Result holds the result of applying an analyzer to a package.
 type Result = checker.TestAnalyzerResult
 
 // loadPackages uses go/packages to load a specified packages (from source, with
 // dependencies) from dir, which is the root of a GOPATH-style project
-// tree. It returns an error if any package had an error, or the pattern
-// matched no packages.
-func loadPackages(dir string, patterns ...string) ([]*packages.Package, error) {
+// tree or of a module. It returns an error if any package had an error,
+// or the pattern matched no packages. It logs to t each package that it
+// excludes because of errors (see WithRunDespiteErrors).
+func (r *Runner) loadPackages(t Testing, dir string, patterns ...string) ([]*packages.Package, error) {
 	// packages.Load loads the real standard library, not a minimal
 	// fake version, which would be more efficient, especially if we
 	// have many small tests that import, say, net/http.
@@ -314,32 +1171,155 @@ func loadPackages(dir string, patterns ...string) ([]*packages.Package, error) {
 	// a list of packages we generate and then do the parsing and
 	// typechecking, though this feature seems to be a recurring need.
 
+	env := []string{"GOPATH=" + dir, "GO111MODULE=off", "GOPROXY=off"}
+	root := sourceRoot(dir)
+	if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+		// Workspace mode, and GOWORK, require Go 1.18;
+		// see WriteWorkspace.
+		//
+		// Workspace mode rejects -mod=mod, which GOFLAGS may set.
+		var goflags []string
+		for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+			if !strings.HasPrefix(flag, "-mod=") || flag == "-mod=readonly" || flag == "-mod=vendor" {
+				goflags = append(goflags, flag)
+			}
+		}
+		env = []string{"GO111MODULE=on", "GOPROXY=off", "GOWORK=" + filepath.Join(dir, "go.work"), "GOFLAGS=" + strings.Join(goflags, " ")}
+	} else if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		env = []string{"GO111MODULE=on", "GOPROXY=off", "GOWORK=off"}
+	}
+	if r.cfg.goos != "" {
+		env = append(env, "GOOS="+r.cfg.goos)
+	}
+	if r.cfg.goarch != "" {
+		env = append(env, "GOARCH="+r.cfg.goarch)
+	}
+	if r.cfg.goflags != "" {
+		for _, flag := range strings.Fields(r.cfg.goflags) {
+			if !strings.HasPrefix(flag, "-") {
+				return nil, fmt.Errorf("invalid GOFLAGS %q: %q is not a flag", r.cfg.goflags, flag)
+			}
+		}
+		env = append(env, "GOFLAGS="+r.cfg.goflags)
+	}
 	cfg := &packages.Config{
 		Mode:  packages.LoadAllSyntax,
 		Dir:   dir,
 		Tests: true,
-		Env:   append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off"),
+		Env:   append(os.Environ(), env...),
+		Fset:  r.cfg.fset,
 	}
-	pkgs, err := packages.Load(cfg, patterns...)
-	if err != nil {
-		return nil, err
+	if len(r.cfg.overlay) > 0 {
+		cfg.Overlay = make(map[string][]byte)
+		for name, content := range r.cfg.overlay {
+			cfg.Overlay[filepath.Join(root, filepath.FromSlash(name))] = []byte(content)
+		}
+	}
+	if root == dir {
+		if _, err := os.Stat(filepath.Join(dir, "vendor")); err == nil {
+			cfg.BuildFlags = append(cfg.BuildFlags, "-mod=vendor")
+		}
+	}
+	if len(r.cfg.buildTags) > 0 {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-tags="+strings.Join(r.cfg.buildTags, ","))
+	}
+	if r.cfg.syntaxOnly {
+		// Without NeedTypes, go/packages does not
+		// populate Package.Fset, so we provide one.
+		cfg.Mode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedSyntax
+		if cfg.Fset == nil {
+			cfg.Fset = token.NewFileSet()
+		}
+	}
+	var pkgs []*packages.Package
+	if ResolvePackage != nil {
+		for _, pattern := range patterns {
+			pkg, err := ResolvePackage(dir, pattern)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, pkg)
+		}
+	} else {
+		if r.cfg.replay != "" {
+			if err := replayPackages(cfg, r.cfg.replay, dir, patterns); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		pkgs, err = packages.Load(cfg, patterns...)
+		if err != nil {
+			if r.cfg.goflags != "" {
+				err = fmt.Errorf("%s (with GOFLAGS=%q)", strings.TrimSpace(err.Error()), r.cfg.goflags)
+			}
+			return nil, err
+		}
+		if r.cfg.record != "" {
+			if err := recordPackages(r.cfg.record, dir, patterns, pkgs); err != nil {
+				return nil, fmt.Errorf("recording packages: %v", err)
+			}
+		}
+		if r.cfg.syntaxOnly {
+			for _, pkg := range pkgs {
+				pkg.Fset = cfg.Fset
+			}
+		}
 	}
 
 	// Print errors but do not stop:
 	// some Analyzers may be disposed to RunDespiteErrors.
 	packages.PrintErrors(pkgs)
 
+	if r.cfg.despiteErrors != nil && !*r.cfg.despiteErrors {
+		var ok []*packages.Package
+		for _, pkg := range pkgs {
+			if pkg.IllTyped {
+				logf(t, "excluding package %s, which has errors", pkg.ID)
+			} else {
+				ok = append(ok, pkg)
+			}
+		}
+		pkgs = ok
+	}
+
 	if len(pkgs) == 0 {
 		return nil, fmt.Errorf("no packages matched %s", patterns)
 	}
 	return pkgs, nil
 }
 
+// maxRunaway is the number of diagnostics listed
+// in the report of a package that has too many.
+const maxRunaway = 5
+
+// reportRunaway reports that the analysis of a package produced more
+// than max diagnostics, listing the first few by position.
+func reportRunaway(t Testing, dir string, result *Result, diagnostics []analysis.Diagnostic, max int) {
+	lines := NormalizeFindings(dir, result.Package.Fset, diagnostics)
+	if len(lines) > maxRunaway {
+		lines = append(lines[:maxRunaway], "...")
+	}
+	t.Errorf("analysis of %s reported %d diagnostics, more than the maximum of %d; the first are:\n\t%s",
+		result.Package.ID, len(diagnostics), max, strings.Join(lines, "\n\t"))
+}
+
+// sourceRoot returns the root of the source files of the tree dir:
+// dir itself for a module or workspace, or dir/src for a GOPATH-style
+// tree.
+func sourceRoot(dir string) string {
+	for _, name := range []string{"go.work", "go.mod"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join(dir, "src")
+}
+
 // check inspects an analysis pass on which the analysis has already
 // been run, and verifies that all reported diagnostics and facts match
 // specified by the contents of "// want ..." comments in the package's
 // source files, which must have been parsed with comments enabled.
-func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic, facts map[types.Object][]analysis.Fact) {
+func check(t Testing, cfg *config, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic, facts map[types.Object][]analysis.Fact, errors []packages.Error) {
 	type key struct {
 		file string
 		line int
@@ -347,26 +1327,64 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 
 	want := make(map[key][]expectation)
 
+	// once holds the package-wide expectations of 'want once' comments,
+	// and the number of diagnostics that matched each of them.
+	type packageExpectation struct {
+		key
+		rx      *regexp.Regexp
+		matches int
+	}
+	var once []*packageExpectation
+
+	// keyword introduces expectations, usually "want".
+	keyword := cfg.wantKeyword(pass)
+
 	// processComment parses expectations out of comments.
 	processComment := func(filename string, linenum int, text string) {
 		text = strings.TrimSpace(text)
 
-		// Any comment starting with "want" is treated
-		// as an expectation, even without following whitespace.
-		if rest := strings.TrimPrefix(text, "want"); rest != text {
-			lineDelta, expects, err := parseExpectations(rest)
+		// Any comment starting with "want" (or the keyword of the
+		// package) is treated as an expectation, even without
+		// following whitespace.
+		if rest := strings.TrimPrefix(text, keyword); rest != text {
+			lineDelta, expects, err := parseExpectations(cfg, rest)
 			if err != nil {
 				t.Errorf("%s:%d: in 'want' comment: %s", filename, linenum, err)
 				return
 			}
-			if expects != nil {
-				want[key{filename, linenum + lineDelta}] = expects
+			var lineExpects []expectation
+			for _, exp := range expects {
+				if exp.kind == "once" {
+					once = append(once, &packageExpectation{key: key{filename, linenum}, rx: exp.rx})
+				} else if exp.importPath != "" {
+					line := importLine(pass, gopath, filename, exp.importPath)
+					if line == 0 {
+						t.Errorf("%s:%d: in 'want' comment: file does not import %q", filename, linenum, exp.importPath)
+						continue
+					}
+					exp.line = linenum
+					k := key{filename, line}
+					want[k] = append(want[k], exp)
+				} else {
+					if lineDelta != 0 {
+						exp.line = linenum
+					}
+					lineExpects = append(lineExpects, exp)
+				}
+			}
+			if lineExpects != nil {
+				k := key{filename, linenum + lineDelta}
+				want[k] = append(want[k], lineExpects...)
 			}
 		}
 	}
 
-	// Extract 'want' comments from parsed Go files.
+	// Extract 'want' comments from parsed Go files,
+	// after adding any that are missing, if requested.
 	for _, f := range pass.Files {
+		if cfg.updateWants {
+			writeWants(t, cfg, gopath, pass, f, diagnostics, processComment)
+		}
 		for _, cgroup := range f.Comments {
 			for _, c := range cgroup.List {
 
@@ -381,7 +1399,7 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 				// as if it starts at 'want'.
 				// This allows us to add comments on comments,
 				// as required when testing the buildtag analyzer.
-				if i := strings.Index(text, "// want"); i >= 0 {
+				if i := strings.Index(text, "// "+keyword); i >= 0 {
 					text = text[i+len("// "):]
 				}
 
@@ -398,12 +1416,13 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 
 	// Extract 'want' comments from non-Go files.
 	// TODO(adonovan): we may need to handle //line directives.
-	for _, filename := range pass.OtherFiles {
+	for _, filename := range nonGoFiles(cfg, gopath, pass) {
 		data, err := ioutil.ReadFile(filename)
 		if err != nil {
 			t.Errorf("can't read '// want' comments from %s: %v", filename, err)
 			continue
 		}
+		comment := cfg.commentPrefix(filename)
 		filename := sanitize(gopath, filename)
 		linenum := 0
 		for _, line := range strings.Split(string(data), "\n") {
@@ -414,35 +1433,78 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 			// as if it starts at 'want'.
 			// This allows us to add comments on comments,
 			// as required when testing the buildtag analyzer.
-			if i := strings.Index(line, "// want"); i >= 0 {
+			if i := strings.Index(line, comment+" "+keyword); i >= 0 {
 				line = line[i:]
 			}
 
-			if i := strings.Index(line, "//"); i >= 0 {
-				line = line[i+len("//"):]
+			if i := strings.Index(line, comment); i >= 0 {
+				line = line[i+len(comment):]
 				processComment(filename, linenum, line)
 			}
 		}
 	}
 
-	checkMessage := func(posn token.Position, kind, name, message string) {
+	// Extract expectations from sidecar files,
+	// after regenerating them if requested.
+	for _, f := range pass.Files {
+		filename := pass.Fset.File(f.Pos()).Name()
+		if cfg.updateSidecars {
+			writeSidecar(t, pass, filename, diagnostics)
+		}
+		readSidecar(t, gopath, filename, keyword, processComment)
+	}
+
+	// Count the outcomes, for the summary.
+	var unexpected, matched int
+
+	checkMessage := func(posn token.Position, kind, name, message string, d *analysis.Diagnostic) {
+		filename := posn.Filename
 		posn.Filename = sanitize(gopath, posn.Filename)
 		k := key{posn.Filename, posn.Line}
 		expects := want[k]
 		var unmatched []string
 		for i, exp := range expects {
 			if exp.kind == kind && exp.name == name {
-				if exp.rx.MatchString(message) {
+				if exp.matches(message) {
 					// matched: remove the expectation.
 					expects[i] = expects[len(expects)-1]
 					expects = expects[:len(expects)-1]
 					want[k] = expects
+					matched++
+					if exp.covers != "" && d != nil {
+						checkCovers(t, pass, posn, filename, d, exp.covers)
+					}
+					if exp.url != "" && d != nil {
+						checkURL(t, posn, d, exp.url)
+					}
+					if exp.infunc != "" && d != nil {
+						checkInFunc(t, gopath, pass, posn, d, exp.infunc)
+					}
+					if exp.infile != "" && d != nil {
+						checkInFile(t, pass, posn, d, exp.infile)
+					}
 					return
 				}
-				unmatched = append(unmatched, fmt.Sprintf("%q", exp.rx))
+				unmatched = append(unmatched, exp.describe())
 			}
 		}
+		if kind == "diagnostic" {
+			for _, exp := range once {
+				if exp.rx.MatchString(message) {
+					exp.matches++
+					matched++
+					return
+				}
+			}
+		}
+		unexpected++
+		if kind == "last" {
+			kind = "last diagnostic"
+		}
 		if unmatched == nil {
+			if kind == "diagnostic" && len(expects) == 1 && expects[0].kind == "none" {
+				kind += " on line marked 'want none'"
+			}
 			t.Errorf("%v: unexpected %s: %v", posn, kind, message)
 		} else {
 			t.Errorf("%v: %s %q does not match pattern %s",
@@ -450,11 +1512,164 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 		}
 	}
 
+	// Find the last diagnostic, by column and then by order of report,
+	// of each line that has a 'want last' expectation.
+	last := make(map[key]int) // index in diagnostics
+	for i, d := range diagnostics {
+		posn := pass.Fset.Position(d.Pos)
+		k := key{sanitize(gopath, posn.Filename), posn.Line}
+		for _, exp := range want[k] {
+			if exp.kind == "last" {
+				if j, ok := last[k]; !ok || posn.Column >= pass.Fset.Position(diagnostics[j].Pos).Column {
+					last[k] = i
+				}
+				break
+			}
+		}
+	}
+
+	// Move each tolerant expectation ('want ~N') to the line of the
+	// nearest diagnostic within its window that it matches, among those
+	// that no expectation of their own line would match, if no
+	// diagnostic of its own line would match it; exact matches thus
+	// take priority over tolerant ones.
+	maxTolerance := 0
+	for _, expects := range want {
+		for _, exp := range expects {
+			if exp.tolerance > maxTolerance {
+				maxTolerance = exp.tolerance
+			}
+		}
+	}
+	if maxTolerance > 0 {
+		// Find the expectations that remain free after exact matching,
+		// as indices in want, and the diagnostics that match none.
+		free := make(map[key][]int)
+		for k, expects := range want {
+			for i := range expects {
+				free[k] = append(free[k], i)
+			}
+		}
+		var inexact []int // indices in diagnostics
+	exact:
+		for i, d := range diagnostics {
+			posn := pass.Fset.Position(d.Pos)
+			k := key{sanitize(gopath, posn.Filename), posn.Line}
+			for j, index := range free[k] {
+				if exp := want[k][index]; exp.kind == "diagnostic" && exp.matches(cfg.message(d.Message)) {
+					free[k] = append(free[k][:j:j], free[k][j+1:]...)
+					continue exact
+				}
+			}
+			inexact = append(inexact, i)
+		}
+
+		moved := make(map[key]map[int]bool)
+		type move struct {
+			exp expectation
+			to  key
+		}
+		var moves []move
+	tolerant:
+		for _, i := range inexact {
+			d := diagnostics[i]
+			posn := pass.Fset.Position(d.Pos)
+			k := key{sanitize(gopath, posn.Filename), posn.Line}
+			for delta := 1; delta <= maxTolerance; delta++ {
+				for _, k2 := range []key{{k.file, k.line - delta}, {k.file, k.line + delta}} {
+					for j, index := range free[k2] {
+						if exp := want[k2][index]; exp.kind == "diagnostic" && exp.tolerance >= delta && exp.matches(cfg.message(d.Message)) {
+							free[k2] = append(free[k2][:j:j], free[k2][j+1:]...)
+							if moved[k2] == nil {
+								moved[k2] = make(map[int]bool)
+							}
+							moved[k2][index] = true
+							moves = append(moves, move{exp, k})
+							continue tolerant
+						}
+					}
+				}
+			}
+		}
+		for k, indices := range moved {
+			var expects []expectation
+			for i, exp := range want[k] {
+				if !indices[i] {
+					expects = append(expects, exp)
+				}
+			}
+			want[k] = expects
+		}
+		for _, m := range moves {
+			want[m.to] = append(want[m.to], m.exp)
+		}
+	}
+
 	// Check the diagnostics match expectations.
-	for _, f := range diagnostics {
+	for i, f := range diagnostics {
 		// TODO(matloob): Support ranges in analysistest.
 		posn := pass.Fset.Position(f.Pos)
-		checkMessage(posn, "diagnostic", "", f.Message)
+		message := cfg.message(f.Message)
+		if j, ok := last[key{sanitize(gopath, posn.Filename), posn.Line}]; ok {
+			if i == j {
+				checkMessage(posn, "last", "", message, &diagnostics[i])
+				continue
+			}
+			// The other diagnostics of the line are
+			// ignored unless they match an expectation.
+			ignore := true
+			for _, exp := range want[key{sanitize(gopath, posn.Filename), posn.Line}] {
+				if exp.kind == "diagnostic" && exp.matches(message) {
+					ignore = false
+				}
+			}
+			if ignore {
+				continue
+			}
+		}
+		checkMessage(posn, "diagnostic", "", message, &diagnostics[i])
+	}
+
+	// Check the errors of the package on lines
+	// that expect them, as reported by the loader.
+	files := fileIndex(pass.Fset)
+	for _, err := range errors {
+		pos := decodePosn(files, err.Pos)
+		if !pos.IsValid() {
+			continue
+		}
+		posn := pass.Fset.Position(pos)
+		for _, exp := range want[key{sanitize(gopath, posn.Filename), posn.Line}] {
+			if exp.kind == "compile-error" {
+				checkMessage(posn, "compile-error", "", err.Msg, nil)
+				break
+			}
+		}
+	}
+
+	checkFiles(t, gopath, pass, diagnostics)
+	checkEmptyMessages(t, gopath, pass, diagnostics)
+	checkUTF8(t, gopath, pass, diagnostics)
+	if cfg.regions {
+		checkRegions(t, gopath, pass, diagnostics)
+	}
+	if cfg.narrowLines > 0 {
+		checkNarrow(t, cfg.narrowLines, gopath, pass, diagnostics)
+	}
+	if cfg.noFixes {
+		checkNoFixes(t, gopath, pass, diagnostics)
+	}
+	if cfg.noDups {
+		checkDuplicates(t, gopath, pass, diagnostics)
+	}
+	if cfg.category {
+		checkCategory(t, gopath, pass, diagnostics)
+	}
+	if cfg.noInText {
+		checkInText(t, gopath, pass, diagnostics)
+	}
+	if cfg.suppress != "" {
+		checkSuppressed(t, cfg.suppress, cfg.suppressNext, gopath, pass, diagnostics)
 	}
 
 	// Check the facts match expectations.
@@ -489,7 +1704,7 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 		}
 
 		for _, fact := range facts[obj] {
-			checkMessage(posn, "fact", name, fmt.Sprint(fact))
+			checkMessage(posn, "fact", name, fmt.Sprint(fact), nil)
 		}
 	}
 
@@ -503,7 +1718,29 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 	var surplus []string
 	for key, expects := range want {
 		for _, exp := range expects {
-			err := fmt.Sprintf("%s:%d: no %s was reported matching %q", key.file, key.line, exp.kind, exp.rx)
+			if exp.kind == "none" {
+				continue // satisfied by the absence of diagnostics
+			}
+			kind := exp.kind
+			if kind == "last" {
+				kind = "diagnostic"
+			}
+			err := fmt.Sprintf("%s:%d: no %s was reported matching %s", key.file, key.line, kind, exp.describe())
+			if exp.line != 0 {
+				err += fmt.Sprintf(" (want comment at %s:%d)", key.file, exp.line)
+			}
+			surplus = append(surplus, err)
+		}
+	}
+	for _, exp := range once {
+		switch exp.matches {
+		case 0:
+			err := fmt.Sprintf("%s:%d: no diagnostic was reported in the package matching %q", exp.file, exp.line, exp.rx)
+			surplus = append(surplus, err)
+		case 1:
+			// ok
+		default:
+			err := fmt.Sprintf("%s:%d: %d diagnostics were reported in the package matching %q; want exactly one", exp.file, exp.line, exp.matches, exp.rx)
 			surplus = append(surplus, err)
 		}
 	}
@@ -511,28 +1748,140 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 	for _, err := range surplus {
 		t.Errorf("%s", err)
 	}
+
+	// Summarize the failures of the package.
+	if unexpected > 0 || len(surplus) > 0 {
+		name := "package"
+		if pass.Pkg != nil {
+			name = "package " + pass.Pkg.Path()
+		}
+		logf(t, "%s: %d unexpected diagnostics or facts, %d unmet expectations, %d matched",
+			name, unexpected, len(surplus), matched)
+	}
+}
+
+// nonGoFiles returns the names of the non-Go files of the package
+// that may contain 'want' comments: its OtherFiles, plus any files in
+// its directory that have an extension specified by WithNonGoFiles.
+func nonGoFiles(cfg *config, gopath string, pass *analysis.Pass) []string {
+	files := pass.OtherFiles
+	if len(cfg.nonGoFiles) == 0 {
+		return files
+	}
+
+	seen := make(map[string]bool)
+	for _, filename := range files {
+		seen[filename] = true
+	}
+	dirs := make(map[string]bool)
+	for _, f := range pass.Files {
+		dir := filepath.Dir(pass.Fset.File(f.Pos()).Name())
+		if dirs[dir] || !strings.HasPrefix(dir, gopath) {
+			continue // already seen, or not a fixture (e.g. generated by cgo)
+		}
+		dirs[dir] = true
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			filename := filepath.Join(dir, entry.Name())
+			if _, ok := cfg.nonGoFiles[filepath.Ext(filename)]; ok && !entry.IsDir() && !seen[filename] {
+				seen[filename] = true
+				files = append(files, filename)
+			}
+		}
+	}
+	return files
 }
 
 type expectation struct {
-	kind string // either "fact" or "diagnostic"
-	name string // name of object to which fact belongs, or "package" ("fact" only)
-	rx   *regexp.Regexp
+	kind       string           // "fact", "diagnostic", "compile-error", "last", "none", or "once"
+	name       string           // name of object to which fact belongs, or "package" ("fact" only)
+	rx         *regexp.Regexp   // pattern to match, if alts is nil
+	alts       []*regexp.Regexp // alternative patterns of an any:"rx"... expectation
+	text       string           // exact message of a sprintf:"format" args... expectation, if rx and alts are nil
+	prefix     bool             // text is a prefix of the message, not all of it (prefix:"text")
+	covers     string           // source text that the range of the diagnostic must span (covers:"text" "rx")
+	url        string           // URL of the diagnostic ("rx" url:"url")
+	infunc     string           // name of the function whose body contains the diagnostic (infunc:"name" "rx")
+	infile     string           // "generated" or "normal", the kind of file of the diagnostic (ingenerated "rx")
+	importPath string           // path of the import spec on whose line the diagnostic is expected (import:"path" "rx")
+	tolerance  int              // number of lines by which the diagnostic may be away from its expected line (~N "rx")
+	code       *regexp.Regexp   // if non-nil, extracts the code of the message, which must equal text (code:"text")
+	id         *regexp.Regexp   // if non-nil, extracts the rule ID of the message, which must equal text (id:text)
+	line       int              // line of the 'want' comment, if not that of the expected diagnostic or fact
 }
 
 func (ex expectation) String() string {
-	return fmt.Sprintf("%s %s:%q", ex.kind, ex.name, ex.rx) // for debugging
+	return fmt.Sprintf("%s %s:%s", ex.kind, ex.name, ex.describe()) // for debugging
+}
+
+// matches reports whether message matches the expectation's pattern,
+// or any of its alternatives.
+func (ex expectation) matches(message string) bool {
+	if ex.alts != nil {
+		for _, rx := range ex.alts {
+			if rx.MatchString(message) {
+				return true
+			}
+		}
+		return false
+	}
+	if ex.code != nil {
+		m := ex.code.FindStringSubmatch(message)
+		return len(m) > 1 && m[1] == ex.text
+	}
+	if ex.id != nil {
+		m := ex.id.FindStringSubmatch(message)
+		return len(m) > 1 && m[1] == ex.text
+	}
+	if ex.rx == nil {
+		if ex.prefix {
+			return strings.HasPrefix(message, ex.text)
+		}
+		return message == ex.text
+	}
+	return ex.rx.MatchString(message)
+}
+
+// describe returns the expectation's pattern, or all of its
+// alternatives, or its exact message, in quoted form for use in error
+// messages.
+func (ex expectation) describe() string {
+	if ex.alts != nil {
+		var alts []string
+		for _, rx := range ex.alts {
+			alts = append(alts, fmt.Sprintf("%q", rx))
+		}
+		return "any of " + strings.Join(alts, ", ")
+	}
+	if ex.code != nil {
+		return fmt.Sprintf("code %q", ex.text)
+	}
+	if ex.id != nil {
+		return fmt.Sprintf("id %s", ex.text)
+	}
+	if ex.rx == nil {
+		if ex.prefix {
+			return fmt.Sprintf("prefix %q", ex.text)
+		}
+		return fmt.Sprintf("%q", ex.text)
+	}
+	return fmt.Sprintf("%q", ex.rx)
 }
 
 // parseExpectations parses the content of a "// want ..." comment
 // and returns the expectations, a mixture of diagnostics ("rx") and
 // facts (name:"rx").
-func parseExpectations(text string) (lineDelta int, expects []expectation, err error) {
+func parseExpectations(cfg *config, text string) (lineDelta int, expects []expectation, err error) {
 	var scanErr string
+	var tolerance int // see '~N'
 	sc := new(scanner.Scanner).Init(strings.NewReader(text))
 	sc.Error = func(s *scanner.Scanner, msg string) {
 		scanErr = msg // e.g. bad string escape
 	}
-	sc.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanInts
+	sc.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanInts | scanner.ScanFloats
 
 	scanRegexp := func(tok rune) (*regexp.Regexp, error) {
 		if tok != scanner.String && tok != scanner.RawString {
@@ -540,11 +1889,21 @@ func parseExpectations(text string) (lineDelta int, expects []expectation, err e
 				scanner.TokenString(tok))
 		}
 		pattern, _ := strconv.Unquote(sc.TokenText()) // can't fail
-		return regexp.Compile(pattern)
+		return cfg.compile(pattern)
+	}
+
+	// unread holds a token that has been scanned but not consumed.
+	var unread rune
+	scan := func() rune {
+		if tok := unread; tok != 0 {
+			unread = 0
+			return tok
+		}
+		return sc.Scan()
 	}
 
 	for {
-		tok := sc.Scan()
+		tok := scan()
 		switch tok {
 		case '+':
 			tok = sc.Scan()
@@ -552,31 +1911,268 @@ func parseExpectations(text string) (lineDelta int, expects []expectation, err e
 				return 0, nil, fmt.Errorf("got +%s, want +Int", scanner.TokenString(tok))
 			}
 			lineDelta, _ = strconv.Atoi(sc.TokenText())
+		case '~':
+			tok = sc.Scan()
+			if tok != scanner.Int {
+				return 0, nil, fmt.Errorf("got ~%s, want ~Int", scanner.TokenString(tok))
+			}
+			tolerance, _ = strconv.Atoi(sc.TokenText())
 		case scanner.String, scanner.RawString:
 			rx, err := scanRegexp(tok)
 			if err != nil {
 				return 0, nil, err
 			}
-			expects = append(expects, expectation{"diagnostic", "", rx})
+			expects = append(expects, expectation{kind: "diagnostic", rx: rx})
 
 		case scanner.Ident:
 			name := sc.TokenText()
+			if name == "none" && sc.Peek() != ':' {
+				// "none" asserts the absence of diagnostics.
+				expects = append(expects, expectation{kind: "none"})
+				continue
+			}
+			if name == "any" && sc.Peek() == ':' {
+				// any:"rx1" "rx2" ... matches a diagnostic
+				// that matches any of the alternatives,
+				// which are all the strings that follow.
+				sc.Scan() // ':'
+				var alts []*regexp.Regexp
+				for tok = sc.Scan(); tok == scanner.String || tok == scanner.RawString || alts == nil; tok = sc.Scan() {
+					rx, err := scanRegexp(tok)
+					if err != nil {
+						return 0, nil, err
+					}
+					alts = append(alts, rx)
+				}
+				expects = append(expects, expectation{kind: "diagnostic", alts: alts})
+				unread = tok
+				continue
+			}
+			if name == "sprintf" && sc.Peek() == ':' {
+				// sprintf:"format" args... matches a diagnostic
+				// whose message is exactly the result of formatting
+				// the args, which are all the identifiers (as
+				// strings) and numbers that follow.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after sprintf:, want format string",
+						scanner.TokenString(tok))
+				}
+				format, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				var args []interface{}
+			args:
+				for tok = sc.Scan(); ; tok = sc.Scan() {
+					switch tok {
+					case scanner.Ident:
+						if sc.Peek() == ':' {
+							break args // a fact expectation
+						}
+						args = append(args, sc.TokenText())
+					case scanner.Int:
+						v, err := strconv.ParseInt(sc.TokenText(), 0, 64)
+						if err != nil {
+							return 0, nil, err
+						}
+						args = append(args, v)
+					case scanner.Float:
+						v, err := strconv.ParseFloat(sc.TokenText(), 64)
+						if err != nil {
+							return 0, nil, err
+						}
+						args = append(args, v)
+					default:
+						break args
+					}
+				}
+				expects = append(expects, expectation{kind: "diagnostic", text: cfg.message(fmt.Sprintf(format, args...))})
+				unread = tok
+				continue
+			}
+			if name == "prefix" && sc.Peek() == ':' {
+				// prefix:"text" matches a diagnostic whose
+				// message starts with the literal text.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after prefix:, want string",
+						scanner.TokenString(tok))
+				}
+				text, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				expects = append(expects, expectation{kind: "diagnostic", text: text, prefix: true})
+				continue
+			}
+			if name == "compile" && sc.Peek() == '-' {
+				// compile-error "rx" matches an error
+				// reported by the loader, such as a type error.
+				sc.Scan() // '-'
+				if tok = sc.Scan(); tok != scanner.Ident || sc.TokenText() != "error" {
+					return 0, nil, fmt.Errorf("got compile-%s, want compile-error", sc.TokenText())
+				}
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "compile-error", rx: rx})
+				continue
+			}
+			if name == "code" && sc.Peek() == ':' {
+				// code:"text" matches a diagnostic whose
+				// message has the code text; see WithCodePattern.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after code:, want string",
+						scanner.TokenString(tok))
+				}
+				text, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				expects = append(expects, expectation{kind: "diagnostic", text: text, code: cfg.codeOf()})
+				continue
+			}
+			if name == "covers" && sc.Peek() == ':' {
+				// covers:"text" "rx" matches a diagnostic whose
+				// message matches rx and whose range spans
+				// exactly the literal text.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after covers:, want string",
+						scanner.TokenString(tok))
+				}
+				text, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "diagnostic", rx: rx, covers: text})
+				continue
+			}
+			if name == "import" && sc.Peek() == ':' {
+				// import:"path" "rx" matches a diagnostic whose
+				// message matches rx on the line of the import
+				// spec of path.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after import:, want string",
+						scanner.TokenString(tok))
+				}
+				text, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "diagnostic", rx: rx, importPath: text})
+				continue
+			}
+			if name == "infunc" && sc.Peek() == ':' {
+				// infunc:"name" "rx" matches a diagnostic whose
+				// message matches rx and which is within the
+				// body of the named function.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after infunc:, want string",
+						scanner.TokenString(tok))
+				}
+				text, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "diagnostic", rx: rx, infunc: text})
+				continue
+			}
+			if (name == "ingenerated" || name == "innormal") && sc.Peek() != ':' {
+				// ingenerated "rx" and innormal "rx" match a
+				// diagnostic whose message matches rx and whose
+				// file is, or is not, generated.
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "diagnostic", rx: rx, infile: strings.TrimPrefix(name, "in")})
+				continue
+			}
+			if name == "url" && sc.Peek() == ':' {
+				// "rx" url:"url" asserts that the diagnostic
+				// matched by the preceding expectation has the URL.
+				sc.Scan() // ':'
+				tok = sc.Scan()
+				if tok != scanner.String && tok != scanner.RawString {
+					return 0, nil, fmt.Errorf("got %s after url:, want string",
+						scanner.TokenString(tok))
+				}
+				if len(expects) == 0 || expects[len(expects)-1].kind != "diagnostic" || expects[len(expects)-1].url != "" {
+					return 0, nil, fmt.Errorf("url: must follow a diagnostic expectation")
+				}
+				url, _ := strconv.Unquote(sc.TokenText()) // can't fail
+				expects[len(expects)-1].url = url
+				continue
+			}
+			if name == "last" && sc.Peek() != ':' {
+				// last "rx" matches the last diagnostic
+				// on the line, which must match rx.
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "last", rx: rx})
+				continue
+			}
+			if name == "once" && sc.Peek() != ':' {
+				// once "rx" asserts that exactly one diagnostic
+				// in the package matches rx.
+				rx, err := scanRegexp(sc.Scan())
+				if err != nil {
+					return 0, nil, err
+				}
+				expects = append(expects, expectation{kind: "once", rx: rx})
+				continue
+			}
 			tok = sc.Scan()
 			if tok != ':' {
 				return 0, nil, fmt.Errorf("got %s after %s, want ':'",
 					scanner.TokenString(tok), name)
 			}
 			tok = sc.Scan()
+			if name == "id" && (tok == scanner.Ident || tok == scanner.Int) {
+				// id:R1234 matches a diagnostic whose message
+				// has the rule ID R1234; see WithIDPattern.
+				// (id:"rx" is a fact of an object named id.)
+				if cfg.idPattern == nil {
+					return 0, nil, fmt.Errorf("id:%s requires WithIDPattern", sc.TokenText())
+				}
+				expects = append(expects, expectation{kind: "diagnostic", text: sc.TokenText(), id: cfg.idPattern})
+				continue
+			}
 			rx, err := scanRegexp(tok)
 			if err != nil {
 				return 0, nil, err
 			}
-			expects = append(expects, expectation{"fact", name, rx})
+			expects = append(expects, expectation{kind: "fact", name: name, rx: rx})
 
 		case scanner.EOF:
 			if scanErr != "" {
 				return 0, nil, fmt.Errorf("%s", scanErr)
 			}
+			lasts := 0
+			for _, exp := range expects {
+				if exp.kind == "none" && len(expects) > 1 {
+					return 0, nil, fmt.Errorf("none cannot be combined with other expectations")
+				}
+				if exp.kind == "last" {
+					lasts++
+				}
+			}
+			if lasts > 1 {
+				return 0, nil, fmt.Errorf("a line has only one last diagnostic")
+			}
+			for i := range expects {
+				if expects[i].kind == "diagnostic" {
+					expects[i].tolerance = tolerance
+				}
+			}
 			return lineDelta, expects, nil
 
 		default:
@@ -585,9 +2181,12 @@ func parseExpectations(text string) (lineDelta int, expects []expectation, err e
 	}
 }
 
-// sanitize removes the GOPATH portion of the filename,
+// sanitize removes the GOPATH (or module root) portion of the filename,
 // typically a gnarly /tmp directory, and returns the rest.
 func sanitize(gopath, filename string) string {
 	prefix := gopath + string(os.PathSeparator) + "src" + string(os.PathSeparator)
+	if !strings.HasPrefix(filename, prefix) {
+		prefix = gopath + string(os.PathSeparator) // module mode
+	}
 	return filepath.ToSlash(strings.TrimPrefix(filename, prefix))
 }
@@ -6,14 +6,24 @@ package analysistest_test
 
 import (
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
 
+	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/analysistest"
 	"golang.org/x/tools/go/analysis/passes/findcall"
+	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/internal/testenv"
 )
 
@@ -155,6 +165,1578 @@ func println(...interface{}) { println_TEST_() } // want println:"found" "call o
 	}
 }
 
+// TestModule tests loading of a module whose dependency
+// is replaced by a local stub.
+func TestModule(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteModule("example.com/a",
+		map[string]string{
+			"a.go": `package a
+
+import "example.com/dep"
+
+func f() {
+	dep.Heavy() // want "call of example.com/dep.Heavy"
+}
+`,
+		},
+		map[string]map[string]string{
+			"example.com/dep": {"dep.go": `package dep
+
+func Heavy() {}
+`},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, depcall, "example.com/a")
+}
+
+// TestVendor tests loading of a module whose dependency
+// is vendored.
+func TestVendor(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteVendoredModule("example.com/a",
+		map[string]string{
+			"a.go": `package a
+
+import "example.com/dep"
+
+func f() {
+	dep.Heavy() // want "call of example.com/dep.Heavy"
+}
+`,
+		},
+		map[string]map[string]string{
+			"example.com/dep": {"dep.go": `package dep
+
+func Heavy() {}
+`},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, depcall, "example.com/a")
+}
+
+// TestRunDir tests loading of an existing directory given by a
+// relative name or a symbolic link.
+func TestRunDir(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(cwd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("can't create symbolic link: %v", err)
+	}
+
+	// File names are relative to the directory however it is named.
+	for _, dir := range []string{rel, link} {
+		var got []string
+		t2 := errorfunc(func(s string) { got = append(got, s) })
+		analysistest.RunDir(t2, dir, printcall, "a")
+		want := []string{
+			`a/a.go:4:2: diagnostic "call of print" does not match pattern "call of println"`,
+			`a/a.go:4: no diagnostic was reported matching "call of println"`,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("RunDir(%s): got:\n%s\nwant:\n%s", dir, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunDir(t2, filepath.Join(dir, "src"), printcall, "a")
+	want := []string{filepath.Join(dir, "src") + " is not the root of a GOPATH-style tree, a module, or a workspace"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestNestedModule tests loading of a module containing a nested
+// module, whose import paths differ from its directories.
+func TestNestedModule(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteModule("example.com/a", map[string]string{
+		"a.go": `package a
+
+import "example.com/dep"
+
+func f() {
+	dep.Heavy() // want "call of example.com/dep.Heavy"
+}
+`,
+		"lib/go.mod": "module example.com/dep\n",
+		"lib/dep.go": `package dep
+
+func Heavy() {}
+`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	results := analysistest.Run(t, dir, depcall, "example.com/a", "example.com/dep")
+	var got []string
+	for _, result := range results {
+		for _, f := range result.Pass.Files {
+			filename := result.Pass.Fset.File(f.Pos()).Name()
+			got = append(got, result.Pass.Pkg.Path()+": "+filepath.ToSlash(strings.TrimPrefix(filename, dir+string(filepath.Separator))))
+		}
+	}
+	sort.Strings(got)
+	want := []string{"example.com/a: a.go", "example.com/dep: lib/dep.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+}
+
+// TestWorkspace tests loading of a workspace of two modules,
+// one of which uses the other.
+func TestWorkspace(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+	testenv.NeedsGo1Point(t, 18)
+
+	dir, cleanup, err := analysistest.WriteWorkspace(map[string]map[string]string{
+		"example.com/a": {
+			"a.go": `package a
+
+import "example.com/dep"
+
+func f() {
+	dep.Heavy() // want "call of example.com/dep.Heavy"
+}
+`,
+		},
+		"example.com/dep": {
+			"dep.go": `package dep
+
+func Heavy() {}
+`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, depcall, "example.com/a", "example.com/dep")
+}
+
+// TestTxtar tests fixtures written from txtar archives.
+func TestTxtar(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteTxtar([]byte(`This fixture tests calls in two files.
+-- a/a.go --
+package a
+
+func f() {
+	print() // want "call of print"
+}
+-- a/b.go --
+package a
+
+func g() {
+	println() // want "call of println"
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, printcall, "a")
+
+	_, _, err = analysistest.WriteTxtar([]byte("-- a/a.go --\npackage a\n-- a/a.go --\npackage a\n"))
+	if want := "txtar archive contains file a/a.go twice"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// TestResolvePackage tests loading with a ResolvePackage function
+// that maps patterns to directories without the go command.
+func TestResolvePackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := `package a
+
+func f() {
+	print() // want "call of print"
+}
+`
+	if err := os.MkdirAll(filepath.Join(dir, "pkgs", "a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkgs", "a", "a.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var patterns []string
+	defer func() { analysistest.ResolvePackage = nil }()
+	analysistest.ResolvePackage = func(dir, pattern string) (*packages.Package, error) {
+		patterns = append(patterns, pattern)
+		filename := filepath.Join(dir, "pkgs", pattern, pattern+".go")
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		info := &types.Info{
+			Types: make(map[ast.Expr]types.TypeAndValue),
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+		}
+		pkg, err := new(types.Config).Check(pattern, fset, []*ast.File{f}, info)
+		if err != nil {
+			return nil, err
+		}
+		return &packages.Package{
+			ID:              pattern,
+			Name:            pkg.Name(),
+			PkgPath:         pattern,
+			GoFiles:         []string{filename},
+			CompiledGoFiles: []string{filename},
+			Fset:            fset,
+			Syntax:          []*ast.File{f},
+			Types:           pkg,
+			TypesInfo:       info,
+			TypesSizes:      types.SizesFor("gc", "amd64"),
+		}, nil
+	}
+
+	analysistest.Run(t, dir, printcall, "a")
+	if want := []string{"a"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("resolved patterns %q, want %q", patterns, want)
+	}
+}
+
+// TestTempDir tests that WriteFiles uses TempDir,
+// and that file names are relative to it.
+func TestTempDir(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	base, err := ioutil.TempDir("", "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	defer func(prev string) { analysistest.TempDir = prev }(analysistest.TempDir)
+	analysistest.TempDir = base
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if filepath.Dir(dir) != base {
+		t.Errorf("WriteFiles created %s, want a directory in %s", dir, base)
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{"a/a.go:4:2: unexpected diagnostic: call of print"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestSuppression tests 'want none' expectations on lines
+// bearing suppression comments.
+func TestSuppression(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+	println() //nolint // want none
+	println() //lint:ignore printcall we want this
+	println() //lint:ignore printcall reason // want none
+	print()   // want none
+	print()   // want none "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+
+	want := []string{
+		`a/a.go:9: in 'want' comment: none cannot be combined with other expectations`,
+		`a/a.go:8:2: unexpected diagnostic on line marked 'want none': call of print`,
+		`a/a.go:9:2: unexpected diagnostic: call of print`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestDeferredDiagnostics tests that diagnostics reported at the end
+// of a pass, after its traversal, are checked.
+func TestDeferredDiagnostics(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want "call of println"
+}
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// latecall reports the calls of print, in reverse order, from a
+	// deferred function, and those of println from goroutines that
+	// it awaits.
+	latecall := &analysis.Analyzer{
+		Name: "latecall",
+		Doc:  "report calls of print and println at the end of the pass",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			var prints, printlns []*ast.CallExpr
+			defer func() {
+				for i := len(prints) - 1; i >= 0; i-- {
+					pass.Reportf(prints[i].Pos(), "call of print")
+				}
+			}()
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if isIdent(call.Fun, "print") {
+							prints = append(prints, call)
+						} else if isIdent(call.Fun, "println") {
+							printlns = append(printlns, call)
+						}
+					}
+					return true
+				})
+			}
+			done := make(chan bool)
+			for _, call := range printlns {
+				go func(call *ast.CallExpr) {
+					pass.Reportf(call.Pos(), "call of println")
+					done <- true
+				}(call)
+			}
+			for range printlns {
+				<-done
+			}
+			return nil, nil
+		},
+	}
+	analysistest.Run(t, dir, latecall, "a")
+}
+
+// TestLast tests 'want last' expectations.
+func TestLast(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print(len(""), cap([]int{})) // want last "call of cap"
+	print(len(""))               // want last "call of len" "call of print"
+	print(len(""))               // want last "call of print"
+	print()                      // want last "call of print" last "call"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// anycall reports each call of a named function.
+	anycall := &analysis.Analyzer{
+		Name: "anycall",
+		Doc:  "report calls of named functions",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if id, ok := call.Fun.(*ast.Ident); ok {
+							pass.Reportf(call.Pos(), "call of %s", id.Name)
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, anycall, "a")
+	want := []string{
+		`a/a.go:7: in 'want' comment: a line has only one last diagnostic`,
+		`a/a.go:6:8: last diagnostic "call of len" does not match pattern "call of print"`,
+		`a/a.go:7:2: unexpected diagnostic: call of print`,
+		`a/a.go:6: no diagnostic was reported matching "call of print"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestOnce tests package-wide 'want once' expectations.
+func TestOnce(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a // want once "call of println" once "call of print$" once "call of panic"
+
+func f() {
+	println()
+	print()
+}
+`,
+		"a/b.go": `package a
+
+func g() {
+	print()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+
+	want := []string{
+		`a/a.go:1: 2 diagnostics were reported in the package matching "call of print$"; want exactly one`,
+		`a/a.go:1: no diagnostic was reported in the package matching "call of panic"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestAlternatives tests 'want any:' expectations.
+func TestAlternatives(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println()          // want any:"call of panic" "call of println"
+	print()            // want any:"call of panic" ` + "`call of recover`" + `
+	println(); print() // want "call of print$" any:"nope" "call of println"
+	print()            // want any:
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+
+	want := []string{
+		`a/a.go:7: in 'want' comment: got EOF, want regular expression`,
+		`a/a.go:5:2: diagnostic "call of print" does not match pattern any of "call of panic", "call of recover"`,
+		`a/a.go:7:2: unexpected diagnostic: call of print`,
+		`a/a.go:5: no diagnostic was reported matching any of "call of panic", "call of recover"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestSprintf tests sprintf:"format" args... expectations.
+func TestSprintf(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want sprintf:"call of %s" print
+	println() // want sprintf:"call of %q" println
+	print()   // want sprintf:"call of %s, %d, %.1f" print 1 2.5
+	print()   // want sprintf:"call of %s" pri
+	print(); println() // want sprintf:"call of %s" print "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of println" does not match pattern "call of \"println\""`,
+		`a/a.go:6:2: diagnostic "call of print" does not match pattern "call of print, 1, 2.5"`,
+		`a/a.go:7:2: diagnostic "call of print" does not match pattern "call of pri"`,
+		`a/a.go:5: no diagnostic was reported matching "call of \"println\""`,
+		`a/a.go:6: no diagnostic was reported matching "call of print, 1, 2.5"`,
+		`a/a.go:7: no diagnostic was reported matching "call of pri"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestPrefix tests prefix:"text" expectations.
+func TestPrefix(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want prefix:"call of"
+	println() // want prefix:"call of print"
+	print()   // want prefix:"call of ("
+	print()   // want prefix:"call of print" "call"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:6:2: diagnostic "call of print" does not match pattern prefix "call of ("`,
+		`a/a.go:6: no diagnostic was reported matching prefix "call of ("`,
+		`a/a.go:7: no diagnostic was reported matching "call"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCovers(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {} // want covers:"f" "f"
+
+func wideG() {} // want covers:"wideG" "wideG"
+
+func h() {
+	print() // want covers:"print" "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// funcdecl reports the range of the name of f,
+	// but of the whole declaration of wideG.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, funcdecl, "a")
+	want := []string{
+		`a/a.go:5:1: diagnostic "wideG" covers "func wideG() {}", want "wideG"`,
+		`a/a.go:7:6: unexpected diagnostic: h`,
+		`a/a.go:8: no diagnostic was reported matching "call of print"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// printcall reports only positions.
+	got = nil
+	analysistest.Run(t2, dir, printcall, "a")
+	want = []string{
+		`a/a.go:8:2: diagnostic "call of print" has no end position, so cannot be checked to cover "print"`,
+		`a/a.go:3: no diagnostic was reported matching "f"`,
+		`a/a.go:5: no diagnostic was reported matching "wideG"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestURL(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print" url:"https://example.com/print"
+	print()   // want "call of print" url:"https://example.com/println"
+	println() // want "call of println" url:"https://example.com/println"
+	println() // want "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// docprint documents its diagnostics of print calls only.
+	docprint := &analysis.Analyzer{
+		Name: "docprint",
+		Doc:  "report calls of print and println",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if id, ok := call.Fun.(*ast.Ident); ok {
+							d := analysis.Diagnostic{Pos: call.Pos(), Message: "call of " + id.Name}
+							if id.Name == "print" {
+								d.URL = "https://example.com/print"
+							}
+							pass.Report(d)
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, docprint, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of print" has URL "https://example.com/print", want "https://example.com/println"`,
+		`a/a.go:6:2: diagnostic "call of println" has no URL, want "https://example.com/println"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInFunc(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+type T int
+
+func f() {
+	print() // want infunc:"f" "call of print"
+	print() // want infunc:"g" "call of print"
+	print() // want infunc:"h" "call of print"
+}
+
+func g() {}
+
+func (T) f() {
+	print() // want infunc:"T.f" "call of print"
+}
+
+func (*T) g() {
+	print() // want infunc:"T.g" "call of print"
+}
+
+func k() {
+	print() // want infunc:"T.f" "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:6:2: function name f is ambiguous, as it is declared at a/a.go:5:6 and a/a.go:13:10; qualify a method by its receiver type, as in T.f`,
+		`a/a.go:7:2: function name g is ambiguous, as it is declared at a/a.go:11:6 and a/a.go:17:11; qualify a method by its receiver type, as in T.g`,
+		`a/a.go:8:2: no function h is declared in the package`,
+		`a/a.go:22:2: diagnostic "call of print" is not within the body of function T.f`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInGenerated(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want innormal "call of print"
+	print() // want ingenerated "call of print"
+}
+`,
+		"a/gen.go": `// Code generated by gen. DO NOT EDIT.
+
+package a
+
+func g() {
+	print() // want ingenerated "call of print"
+	print() // want innormal "call of print"
+}
+`,
+		"a/notgen.go": `package a
+
+// Code generated by gen. DO NOT EDIT.
+
+func h() {
+	print() // want innormal "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of print" is reported in a file that is not generated`,
+		`a/gen.go:7:2: diagnostic "call of print" is reported in a generated file`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// importspec reports each import spec.
+var importspec = &analysis.Analyzer{
+	Name: "importspec",
+	Doc:  "report import specs",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, spec := range f.Imports {
+				pass.Reportf(spec.Pos(), "import of %s", spec.Path.Value)
+			}
+		}
+		return nil, nil
+	},
+}
+
+func TestImport(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a // want import:"fmt" "import of .fmt." import:"strings" "import of .os."
+
+import (
+	"fmt"
+	"os" // want "import of .os."
+	"strings"
+)
+
+// want import:"errors" "import of .errors."
+
+var _, _, _ = fmt.Sprint, os.Exit, strings.Join
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, importspec, "a")
+	want := []string{
+		`a/a.go:9: in 'want' comment: file does not import "errors"`,
+		`a/a.go:6:2: diagnostic "import of \"strings\"" does not match pattern "import of .os."`,
+		`a/a.go:6: no diagnostic was reported matching "import of .os." (want comment at a/a.go:1)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	// want ~2 "call of print"
+	_ = 0
+	print()
+
+	// want ~1 "call of println"
+	_ = 0
+	println()
+}
+
+func g() {
+	print()
+	print() // want ~1 "call of print"
+	print() // want "call of print"
+}
+
+func h() {
+	print()
+	print() // want ~1 "call of print" "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:10:2: unexpected diagnostic: call of println`,
+		`a/a.go:14:2: unexpected diagnostic: call of print`,
+		`a/a.go:8: no diagnostic was reported matching "call of println"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCode(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want code:"P1"
+	println() // want code:"P1"
+	print()   // want code:"P" "call"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// coded reports calls of print and println with a code,
+	// either in brackets at the start of the message or at its end.
+	coded := func(format string) *analysis.Analyzer {
+		return &analysis.Analyzer{
+			Name: "coded",
+			Doc:  "report calls to print and println, with a code",
+			Run: func(pass *analysis.Pass) (interface{}, error) {
+				for _, f := range pass.Files {
+					ast.Inspect(f, func(n ast.Node) bool {
+						if call, ok := n.(*ast.CallExpr); ok {
+							if id, ok := call.Fun.(*ast.Ident); ok {
+								code := "P1"
+								if id.Name == "println" {
+									code = "P2"
+								}
+								pass.Reportf(call.Pos(), format, code, id.Name)
+							}
+						}
+						return true
+					})
+				}
+				return nil, nil
+			},
+		}
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, coded("[%s] call of %s"), "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "[P2] call of println" does not match pattern code "P1"`,
+		`a/a.go:5: no diagnostic was reported matching code "P1"`,
+		`a/a.go:6: no diagnostic was reported matching code "P"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A code at the end of the message needs another rule.
+	got = nil
+	rx := regexp.MustCompile(`\((\w+)\)$`)
+	analysistest.NewRunner(analysistest.WithCodePattern(rx)).Run(t2, dir, coded("call of %[2]s (%[1]s)"), "a")
+	want = []string{
+		`a/a.go:5:2: diagnostic "call of println (P2)" does not match pattern code "P1"`,
+		`a/a.go:5: no diagnostic was reported matching code "P1"`,
+		`a/a.go:6: no diagnostic was reported matching code "P"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestID(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want id:R1
+	println() // want id:R1
+	print()   // want id:1
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// ruled reports calls of print and println with a rule ID.
+	ruled := &analysis.Analyzer{
+		Name: "ruled",
+		Doc:  "report calls to print and println, with a rule ID",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if id, ok := call.Fun.(*ast.Ident); ok {
+							rule := "R1"
+							if id.Name == "println" {
+								rule = "R2"
+							}
+							pass.Reportf(call.Pos(), "call of %s (rule %s)", id.Name, rule)
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	rx := regexp.MustCompile(`\(rule (\w+)\)`)
+	analysistest.NewRunner(analysistest.WithIDPattern(rx)).Run(t2, dir, ruled, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of println (rule R2)" does not match pattern id R1`,
+		`a/a.go:6:2: diagnostic "call of print (rule R1)" does not match pattern id 1`,
+		`a/a.go:5: no diagnostic was reported matching id R1`,
+		`a/a.go:6: no diagnostic was reported matching id 1`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print(undefined) // want compile-error "undefined: undefined" "call of print"
+	var x int = "s"  // want compile-error "cannot use"
+	println()        // want compile-error "undefined" "call of println"
+	_ = x
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithRunDespiteErrors(true)).Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:6: no compile-error was reported matching "undefined"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestUnmetOffset tests that the error for an unmet expectation of a
+// 'want +N' comment gives the position of the comment too.
+func TestUnmetOffset(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	// want +1 "call of print$"
+	println()
+	// want +1 "call of println"
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of println" does not match pattern "call of print$"`,
+		`a/a.go:5: no diagnostic was reported matching "call of print$" (want comment at a/a.go:4)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestAssembly tests a package containing an assembly file
+// in which the analyzer reports diagnostics.
+func TestAssembly(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func add(x, y int64) int64
+`,
+		"a/a.s": `#include "textflag.h"
+
+TEXT ·add(SB), NOSPLIT, $0-24
+	RET
+
+TEXT ·sub(SB), NOSPLIT, $0-24 // want "sub has no Go declaration"
+	RET
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, asmdecl, "a")
+}
+
+// asmdecl reports each function defined in an assembly file
+// that has no corresponding Go declaration.
+var asmdecl = &analysis.Analyzer{
+	Name: "asmdecl",
+	Doc:  "report undeclared assembly functions",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, filename := range pass.OtherFiles {
+			if !strings.HasSuffix(filename, ".s") {
+				continue
+			}
+			content, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			tf := pass.Fset.AddFile(filename, -1, len(content))
+			tf.SetLinesForContent(content)
+			for i, line := range strings.Split(string(content), "\n") {
+				if !strings.HasPrefix(line, "TEXT ·") {
+					continue
+				}
+				name := strings.TrimPrefix(line[:strings.Index(line, "(")], "TEXT ·")
+				if pass.Pkg.Scope().Lookup(name) == nil {
+					pass.Reportf(tf.LineStart(i+1), "%s has no Go declaration", name)
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+// TestDirectives tests that directive comments such as //go:generate
+// are not confused with 'want' comments on the same or adjacent lines.
+func TestDirectives(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+//go:generate stringer -type=T // want "directive runs stringer"
+// want +1 "directive runs echo"
+//go:generate echo want "not an expectation"
+type T int
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, generate, "a")
+}
+
+// generate reports each //go:generate directive.
+var generate = &analysis.Analyzer{
+	Name: "generate",
+	Doc:  "report go:generate directives",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, cgroup := range f.Comments {
+				for _, c := range cgroup.List {
+					if strings.HasPrefix(c.Text, "//go:generate ") {
+						args := strings.Fields(strings.TrimPrefix(c.Text, "//go:generate "))
+						pass.Reportf(c.Pos(), "directive runs %s", args[0])
+					}
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+// TestNoOpEdits tests the reporting of edits of suggested
+// fixes that do not change the file.
+func TestNoOpEdits(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"a/a.go.golden": `package a
+
+func f() {
+	println() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// renameprint suggests renaming each call of print to println,
+	// with a spurious edit that replaces its arguments by themselves.
+	renameprint := &analysis.Analyzer{
+		Name: "renameprint",
+		Doc:  "rename calls of print",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Pos(),
+							Message: "call of print",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message: "Rename to println",
+								TextEdits: []analysis.TextEdit{
+									{Pos: call.Fun.Pos(), End: call.Fun.End(), NewText: []byte("println")},
+									{Pos: call.Lparen, End: call.Rparen + 1, NewText: []byte("()")},
+								},
+							}},
+						})
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunWithSuggestedFixes(t2, dir, renameprint, "a")
+	want := []string{
+		`a/a.go:4:7: suggested fix "Rename to println" contains a no-op edit, which replaces "()" with identical text`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestEditOrder tests the reporting of edits of suggested
+// fixes that are not in source order.
+func TestEditOrder(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"a/a.go.golden": `package a
+
+func f() {
+	println(1) // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// fillprint suggests renaming each call of print to println
+	// and adding an argument, but the edits are in reverse order.
+	fillprint := &analysis.Analyzer{
+		Name: "fillprint",
+		Doc:  "fill calls of print",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Pos(),
+							Message: "call of print",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message: "Fill call",
+								TextEdits: []analysis.TextEdit{
+									{Pos: call.Rparen, End: call.Rparen, NewText: []byte("1")},
+									{Pos: call.Fun.Pos(), End: call.Fun.End(), NewText: []byte("println")},
+								},
+							}},
+						})
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunWithSuggestedFixes(t2, dir, fillprint, "a")
+	analysistest.RunWithPackageFixes(t2, dir, fillprint, "a")
+	want := []string{
+		`a/a.go:4:2: suggested fix "Fill call" has an edit out of order, which follows the edit at a/a.go:4:8`,
+		`a/a.go:4:2: suggested fix "Fill call" has an edit out of order, which follows the edit at a/a.go:4:8`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestCompilableFixes tests the type-checking of fixed files.
+func TestCompilableFixes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+import "fmt" // want "import of fmt"
+
+var _ = fmt.Sprint()
+`,
+		"a/a.go.golden": `package a
+
+// want "import of fmt"
+
+var _ = fmt.Sprint()
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// removeimport suggests removing each import, even if it is used.
+	removeimport := &analysis.Analyzer{
+		Name: "removeimport",
+		Doc:  "remove imports",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				for _, spec := range f.Imports {
+					pass.Report(analysis.Diagnostic{
+						Pos:     spec.Pos(),
+						Message: "import of fmt",
+						SuggestedFixes: []analysis.SuggestedFix{{
+							Message:   "Remove import",
+							TextEdits: []analysis.TextEdit{{Pos: f.Decls[0].Pos(), End: spec.End()}},
+						}},
+					})
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	// Without the option, the fix matches the golden file.
+	analysistest.RunWithSuggestedFixes(t, dir, removeimport, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithCompilableFixes()).RunWithSuggestedFixes(t2, dir, removeimport, "a")
+	want := []string{
+		"a/a.go: applying suggested fixes produces code that does not compile:\n\ta/a.go:5:9: undefined: fmt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestConstructor tests that RunConstructor applies a fresh analyzer
+// to each package.
+func TestConstructor(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call 1 of println"
+	println() // want "call 2 of println"
+}
+`,
+		"b/b.go": `package b
+
+func g() {
+	println() // want "call 1 of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// newCounter returns an analyzer that numbers the calls of
+	// println it reports, so it must not be shared between packages.
+	calls := 0
+	newCounter := func() *analysis.Analyzer {
+		calls++
+		n := 0
+		return &analysis.Analyzer{
+			Name: "counter",
+			Doc:  "number calls of println",
+			Run: func(pass *analysis.Pass) (interface{}, error) {
+				for _, f := range pass.Files {
+					ast.Inspect(f, func(n2 ast.Node) bool {
+						if call, ok := n2.(*ast.CallExpr); ok {
+							if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "println" {
+								n++
+								pass.Reportf(call.Pos(), "call %d of println", n)
+							}
+						}
+						return true
+					})
+				}
+				return nil, nil
+			},
+		}
+	}
+
+	results := analysistest.RunConstructor(t, dir, newCounter, "a", "b")
+	if len(results) != 2 {
+		t.Errorf("got %d results, want 2", len(results))
+	}
+	if calls != 2 {
+		t.Errorf("constructor was called %d times, want 2", calls)
+	}
+}
+
+// TestSummary tests the summary of the errors of a package.
+func TestSummary(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want "call of print$"
+	print()
+	print() // want "call of print"
+}
+
+func g() {} // want "call of g"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	t2 := new(logger)
+	analysistest.Run(t2, dir, printcall, "a")
+	if len(t2.errors) != 4 {
+		t.Errorf("got %d errors, want 4:\n%s", len(t2.errors), strings.Join(t2.errors, "\n"))
+	}
+	want := []string{"package a: 2 unexpected diagnostics or facts, 2 unmet expectations, 2 matched"}
+	if !reflect.DeepEqual(t2.logs, want) {
+		t.Errorf("got logs %q, want %q", t2.logs, want)
+	}
+}
+
+// TestPackageName tests a package whose name differs from its directory.
+func TestPackageName(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	// pkgname reports the name and path of each package and
+	// of the packages it imports.
+	pkgname := &analysis.Analyzer{
+		Name: "pkgname",
+		Doc:  "report package names",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			pass.Reportf(pass.Files[0].Name.Pos(), "package %s %q", pass.Pkg.Name(), pass.Pkg.Path())
+			for _, imp := range pass.Pkg.Imports() {
+				pass.Reportf(pass.Files[0].Imports[0].Pos(), "import of package %s %q", imp.Name(), imp.Path())
+			}
+			return nil, nil
+		},
+	}
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"bar/bar.go": `package foo // want "package foo \"bar\""
+
+func F() {}
+`,
+		"baz/baz.go": `package baz // want "package baz \"baz\""
+
+import "bar" // want "import of package foo \"bar\""
+
+var _ = foo.F
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, pkgname, "bar", "baz")
+
+	// In module mode, the import path includes the module path.
+	dir, cleanup, err = analysistest.WriteModule("example.com", map[string]string{
+		"bar/bar.go": `package foo // want "package foo \"example.com/bar\""
+
+func F() {}
+`,
+		"baz/baz.go": `package baz // want "package baz \"example.com/baz\""
+
+import "example.com/bar" // want "import of package foo \"example.com/bar\""
+
+var _ = foo.F
+`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, pkgname, "example.com/bar", "example.com/baz")
+}
+
+// printcall reports calls to the built-in print functions,
+// except on lines bearing a //nolint or //lint:ignore comment.
+var printcall = &analysis.Analyzer{
+	Name: "printcall",
+	Doc:  "report calls to print and println",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			suppressed := make(map[int]bool)
+			for _, cgroup := range f.Comments {
+				for _, c := range cgroup.List {
+					if strings.HasPrefix(c.Text, "//nolint") || strings.HasPrefix(c.Text, "//lint:ignore") {
+						suppressed[pass.Fset.Position(c.Pos()).Line] = true
+					}
+				}
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && (id.Name == "print" || id.Name == "println") {
+						if !suppressed[pass.Fset.Position(call.Pos()).Line] {
+							pass.Reportf(call.Pos(), "call of %s", id.Name)
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+// depcall reports each call to a function of package example.com/dep.
+var depcall = &analysis.Analyzer{
+	Name: "depcall",
+	Doc:  "report calls to example.com/dep",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if obj := pass.TypesInfo.Uses[sel.Sel]; obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == "example.com/dep" {
+						pass.Reportf(sel.Pos(), "call of %s.%s", obj.Pkg().Path(), obj.Name())
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
 type errorfunc func(string)
 
 func (f errorfunc) Errorf(format string, args ...interface{}) {
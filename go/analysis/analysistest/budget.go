@@ -0,0 +1,50 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"go/ast"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// nodeVisits counts the syntax nodes of each package visited by the
+// traversals of its inspector by the analyzer; see WithNodeBudget.
+type nodeVisits struct {
+	mu     sync.Mutex
+	counts map[*packages.Package]int
+}
+
+func (v *nodeVisits) record(pkg *packages.Package, nodes int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.counts == nil {
+		v.counts = make(map[*packages.Package]int)
+	}
+	v.counts[pkg] += nodes
+}
+
+// checkBudget reports each package of the results whose nodes were
+// visited more than factor times the number of its nodes.
+func (v *nodeVisits) checkBudget(t Testing, factor int, results []*Result) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, result := range results {
+		pkg := result.Package
+		size := 0
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if n != nil {
+					size++
+				}
+				return true
+			})
+		}
+		if visits := v.counts[pkg]; visits > factor*size {
+			t.Errorf("package %s: analysis visited %d nodes, more than %d times the %d nodes of the package", pkg.ID, visits, factor, size)
+		}
+	}
+}
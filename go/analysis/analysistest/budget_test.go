@@ -0,0 +1,71 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"regexp"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// rescan traverses the whole package once for each function
+// declaration, so its cost grows quadratically.
+var rescan = &analysis.Analyzer{
+	Name:     "rescan",
+	Doc:      "traverse the package once per function",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+		inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(ast.Node) {
+			inspect.Preorder(nil, func(ast.Node) {})
+		})
+		return nil, nil
+	},
+}
+
+func TestNodeBudget(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {}
+func g() {}
+func h() {}
+func i() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// baddecl traverses the package once.
+	analysistest.NewRunner(analysistest.WithNodeBudget(1)).Run(t, dir, baddecl, "a")
+
+	// rescan traverses the package once, and again for each function.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNodeBudget(2)).Run(t2, dir, rescan, "a")
+	want := regexp.MustCompile(`^package a: analysis visited \d+ nodes, more than 2 times the \d+ nodes of the package$`)
+	if len(got) != 1 || !want.MatchString(got[0]) {
+		t.Errorf("got errors %q, want one matching %q", got, want)
+	}
+
+	analysistest.NewRunner(analysistest.WithNodeBudget(5)).Run(t, dir, rescan, "a")
+
+	// Without types, the package is identified by its ID.
+	got = nil
+	analysistest.NewRunner(analysistest.WithNodeBudget(2), analysistest.WithSyntaxOnly()).Run(t2, dir, rescan, "a")
+	if len(got) != 1 || !want.MatchString(got[0]) {
+		t.Errorf("got errors %q, want one matching %q", got, want)
+	}
+}
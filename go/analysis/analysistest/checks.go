@@ -0,0 +1,545 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// This file defines the checks of diagnostics that a Runner performs
+// in addition to 'want' matching. Some, such as checkFiles, always
+// apply; the others apply only if enabled by an Option.
+
+// checkNarrow reports each diagnostic whose range is enclosed only by
+// syntax nodes spanning more than maxLines lines.
+func checkNarrow(t Testing, maxLines int, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		if !d.End.IsValid() || d.End <= d.Pos {
+			continue // point diagnostic
+		}
+		f := enclosingFile(pass, d.Pos)
+		if f == nil {
+			continue
+		}
+		path, _ := astutil.PathEnclosingInterval(f, d.Pos, d.End)
+		if len(path) == 0 {
+			continue
+		}
+		n := path[0]
+		start, end := pass.Fset.Position(n.Pos()), pass.Fset.Position(n.End())
+		if lines := end.Line - start.Line + 1; lines > maxLines {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q is reported at a %T spanning %d lines; want at most %d",
+				posn, d.Message, n, lines, maxLines)
+		}
+	}
+}
+
+// checkNoFixes reports each diagnostic that has suggested fixes.
+func checkNoFixes(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		if len(d.SuggestedFixes) > 0 {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q has %d suggested fixes; want none", posn, d.Message, len(d.SuggestedFixes))
+		}
+	}
+}
+
+// checkDuplicates reports each diagnostic that is reported more than
+// once with the same position and message.
+func checkDuplicates(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	type key struct {
+		pos     token.Pos
+		message string
+	}
+	count := make(map[key]int)
+	var keys []key
+	for _, d := range diagnostics {
+		k := key{d.Pos, d.Message}
+		if count[k] == 0 {
+			keys = append(keys, k)
+		}
+		count[k]++
+	}
+	for _, k := range keys {
+		if n := count[k]; n > 1 {
+			posn := pass.Fset.Position(k.pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q is reported %d times", posn, k.message, n)
+		}
+	}
+}
+
+// checkCategory reports each diagnostic that has no category.
+func checkCategory(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		if d.Category == "" {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q has no category", posn, d.Message)
+		}
+	}
+}
+
+// checkInText reports each diagnostic whose position is within, but
+// not at the start of, a comment or a basic literal.
+func checkInText(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		f := enclosingFile(pass, d.Pos)
+		if f == nil {
+			continue
+		}
+		var kind, text string
+		for _, cgroup := range f.Comments {
+			for _, c := range cgroup.List {
+				if c.Pos() < d.Pos && d.Pos < c.End() {
+					kind, text = "comment", c.Text
+				}
+			}
+		}
+		if path, _ := astutil.PathEnclosingInterval(f, d.Pos, d.Pos); len(path) > 0 {
+			if lit, ok := path[0].(*ast.BasicLit); ok && lit.Pos() < d.Pos && d.Pos < lit.End() {
+				kind, text = "literal", lit.Value
+			}
+		}
+		if kind != "" {
+			if len(text) > maxTextLen {
+				text = text[:maxTextLen] + "..."
+			}
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q is reported within the %s %s", posn, d.Message, kind, text)
+		}
+	}
+}
+
+// maxTextLen is the number of bytes of a comment or literal
+// that an error of checkInText quotes.
+const maxTextLen = 40
+
+// checkEmptyMessages reports each diagnostic whose message is empty or
+// consists only of white space, which is never intended, and usually
+// means that an analyzer failed to format a message in some case.
+func checkEmptyMessages(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		if strings.TrimSpace(d.Message) == "" {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic has an empty message %q", posn, d.Message)
+		}
+	}
+}
+
+// checkUTF8 reports each diagnostic whose message is not valid UTF-8,
+// such as one into which an analyzer spliced the raw bytes of a string
+// literal, and which drivers cannot encode as JSON.
+func checkUTF8(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	for _, d := range diagnostics {
+		if !utf8.ValidString(d.Message) {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic message %q is not valid UTF-8", posn, d.Message)
+		}
+	}
+}
+
+// checkDisabled reports each diagnostic whose category is the name of
+// one of the disabled checks (see WithEnabledChecks).
+func checkDisabled(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic, disabled map[string]bool) {
+	for _, d := range diagnostics {
+		if disabled[d.Category] {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q is reported by check %s, which is disabled", posn, d.Message, d.Category)
+		}
+	}
+}
+
+// checkSuppressed reports each diagnostic on a line suppressed by a
+// comment that begins with directive: the line of the comment, or, if
+// nextLine is set, the line that follows it.
+func checkSuppressed(t Testing, directive string, nextLine bool, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	type key struct {
+		file *token.File
+		line int
+	}
+	suppressed := make(map[key]bool)
+	for _, f := range pass.Files {
+		for _, cgroup := range f.Comments {
+			for _, c := range cgroup.List {
+				if strings.HasPrefix(c.Text, directive) {
+					tf := pass.Fset.File(c.Pos())
+					line := tf.Line(c.Pos())
+					if nextLine {
+						line = tf.Line(c.End()) + 1
+					}
+					suppressed[key{tf, line}] = true
+				}
+			}
+		}
+	}
+	for _, d := range diagnostics {
+		tf := pass.Fset.File(d.Pos)
+		if tf != nil && suppressed[key{tf, tf.Line(d.Pos)}] {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			t.Errorf("%v: diagnostic %q is reported on a line suppressed by %s", posn, d.Message, directive)
+		}
+	}
+}
+
+// checkRegions reports each diagnostic in a file that marks regions
+// with "// BEGIN" and "// END" comments that does not lie within one
+// of them, for analyzers that should report only on some of the
+// declarations of a test file. It also reports a marker that does not
+// begin or end a region. Files without markers are not checked.
+func checkRegions(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	position := func(pos token.Pos) token.Position {
+		posn := pass.Fset.Position(pos)
+		posn.Filename = sanitize(gopath, posn.Filename)
+		return posn
+	}
+	type region struct{ start, end token.Pos }
+	regions := make(map[*token.File][]region)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.Pos())
+		begin := token.NoPos
+		for _, cgroup := range f.Comments {
+			for _, c := range cgroup.List {
+				switch strings.TrimSpace(strings.TrimPrefix(c.Text, "//")) {
+				case "BEGIN":
+					if begin.IsValid() {
+						t.Errorf("%v: BEGIN marker within the region that begins at %v",
+							position(c.Pos()), position(begin))
+					}
+					begin = c.Pos()
+				case "END":
+					if !begin.IsValid() {
+						t.Errorf("%v: END marker without a BEGIN marker", position(c.Pos()))
+						continue
+					}
+					regions[tf] = append(regions[tf], region{begin, c.End()})
+					begin = token.NoPos
+				}
+			}
+		}
+		if begin.IsValid() {
+			t.Errorf("%v: BEGIN marker without an END marker", position(begin))
+			regions[tf] = append(regions[tf], region{begin, token.Pos(tf.Base() + tf.Size())})
+		}
+	}
+	for _, d := range diagnostics {
+		rs, ok := regions[pass.Fset.File(d.Pos)]
+		if !ok {
+			continue
+		}
+		inside := false
+		for _, r := range rs {
+			if r.start <= d.Pos && d.Pos < r.end {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			t.Errorf("%v: diagnostic %q is reported outside the BEGIN and END markers of its file",
+				position(d.Pos), d.Message)
+		}
+	}
+}
+
+// checkEditOrder reports each edit of the suggested fix sf that starts
+// before the edit that precedes it, such as one of a fix whose edits
+// were assembled in the order of a traversal, not in source order.
+func checkEditOrder(t Testing, gopath string, fset *token.FileSet, sf analysis.SuggestedFix) {
+	for i := 1; i < len(sf.TextEdits); i++ {
+		prev, edit := sf.TextEdits[i-1], sf.TextEdits[i]
+		if fset.File(edit.Pos) == fset.File(prev.Pos) && edit.Pos < prev.Pos {
+			posn, prevPosn := fset.Position(edit.Pos), fset.Position(prev.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			prevPosn.Filename = sanitize(gopath, prevPosn.Filename)
+			t.Errorf("%v: suggested fix %q has an edit out of order, which follows the edit at %v", posn, sf.Message, prevPosn)
+		}
+	}
+}
+
+// checkFiles reports each diagnostic whose position is not in one of
+// the files of the package of pass, such as one in a file of an
+// imported package, or in a file added to the FileSet by mistake. The
+// non-Go files of the package directory, which an analyzer may read and
+// report on (see WithNonGoFiles), are considered files of the package,
+// as are the files to which //line directives in its files refer, such
+// as the original cgo sources of cgo-processed files, which an analyzer
+// may parse again, but its files excluded from the build are not.
+func checkFiles(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	files := make(map[*token.File]bool)
+	dirs := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.Pos())
+		files[tf] = true
+		dirs[filepath.Dir(tf.Name())] = true
+
+		// Record the files named by //line directives,
+		// which may apply to any part of f.
+		ast.Inspect(f, func(n ast.Node) bool {
+			if n != nil {
+				names[pass.Fset.Position(n.Pos()).Filename] = true
+			}
+			return true
+		})
+		for _, c := range f.Comments {
+			names[pass.Fset.Position(c.Pos()).Filename] = true
+		}
+	}
+	for _, name := range pass.OtherFiles {
+		names[name] = true
+	}
+	ignored := make(map[string]bool)
+	for _, name := range pass.IgnoredFiles {
+		ignored[name] = true
+	}
+	belongs := func(f *token.File) bool {
+		if f == nil {
+			return false
+		}
+		name := f.Name()
+		return files[f] || names[name] ||
+			!strings.HasSuffix(name, ".go") && !ignored[name] && dirs[filepath.Dir(name)]
+	}
+	pkgname := "the package"
+	if pass.Pkg != nil { // nil with WithSyntaxOnly
+		pkgname = "package " + pass.Pkg.Path()
+	}
+	for _, d := range diagnostics {
+		if !d.Pos.IsValid() {
+			continue // reported as unexpected
+		}
+		if f := pass.Fset.File(d.Pos); !belongs(f) {
+			posn := pass.Fset.Position(d.Pos)
+			posn.Filename = sanitize(gopath, posn.Filename)
+			if f != nil && ignored[f.Name()] {
+				t.Errorf("%v: diagnostic %q is reported in a file that is excluded from the build", posn, d.Message)
+			} else {
+				t.Errorf("%v: diagnostic %q is reported in a file that does not belong to %s", posn, d.Message, pkgname)
+			}
+		}
+	}
+}
+
+// checkCovers reports an error if the range of the diagnostic d, whose
+// position is posn, in the file filename, does not span exactly text.
+func checkCovers(t Testing, pass *analysis.Pass, posn token.Position, filename string, d *analysis.Diagnostic, text string) {
+	if !d.End.IsValid() {
+		t.Errorf("%v: diagnostic %q has no end position, so cannot be checked to cover %q", posn, d.Message, text)
+		return
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Errorf("%v: can't check the range of diagnostic %q: %v", posn, d.Message, err)
+		return
+	}
+	tf := pass.Fset.File(d.Pos)
+	start, end := tf.Offset(d.Pos), int(d.End)-tf.Base()
+	if end < start || end > len(content) || end > tf.Size() {
+		t.Errorf("%v: diagnostic %q has an invalid end position", posn, d.Message)
+		return
+	}
+	if got := string(content[start:end]); got != text {
+		t.Errorf("%v: diagnostic %q covers %q, want %q", posn, d.Message, got, text)
+	}
+}
+
+// checkURL reports an error if the URL of the diagnostic d,
+// reported at posn, is not url.
+func checkURL(t Testing, posn token.Position, d *analysis.Diagnostic, url string) {
+	if d.URL == "" {
+		t.Errorf("%v: diagnostic %q has no URL, want %q", posn, d.Message, url)
+	} else if d.URL != url {
+		t.Errorf("%v: diagnostic %q has URL %q, want %q", posn, d.Message, d.URL, url)
+	}
+}
+
+// checkInFunc reports an error if the diagnostic d, reported at posn,
+// is not within the body of the function declared in pass with the
+// given name, which is of the form "f" or, for a method, "T.f".
+func checkInFunc(t Testing, gopath string, pass *analysis.Pass, posn token.Position, d *analysis.Diagnostic, name string) {
+	var decls []*ast.FuncDecl
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && (decl.Name.Name == name || funcName(decl) == name) {
+				decls = append(decls, decl)
+			}
+		}
+	}
+	switch len(decls) {
+	case 0:
+		t.Errorf("%v: no function %s is declared in the package", posn, name)
+		return
+	case 1:
+	default:
+		var posns []string
+		for _, decl := range decls {
+			p := pass.Fset.Position(decl.Name.Pos())
+			p.Filename = sanitize(gopath, p.Filename)
+			posns = append(posns, p.String())
+		}
+		t.Errorf("%v: function name %s is ambiguous, as it is declared at %s; qualify a method by its receiver type, as in T.%s",
+			posn, name, strings.Join(posns, " and "), name)
+		return
+	}
+	if body := decls[0].Body; body == nil || d.Pos < body.Lbrace || d.Pos > body.Rbrace {
+		t.Errorf("%v: diagnostic %q is not within the body of function %s", posn, d.Message, name)
+	}
+}
+
+// checkInFile reports an error if the file of the diagnostic d,
+// reported at posn, is not of the kind, "generated" or "normal".
+func checkInFile(t Testing, pass *analysis.Pass, posn token.Position, d *analysis.Diagnostic, kind string) {
+	generated := false
+	if f := enclosingFile(pass, d.Pos); f != nil {
+		generated = isGenerated(f)
+	}
+	switch {
+	case kind == "generated" && !generated:
+		t.Errorf("%v: diagnostic %q is reported in a file that is not generated", posn, d.Message)
+	case kind == "normal" && generated:
+		t.Errorf("%v: diagnostic %q is reported in a generated file", posn, d.Message)
+	}
+}
+
+// isGenerated reports whether the file has a comment of the form
+// "// Code generated ... DO NOT EDIT." before its package clause, by
+// the convention for generated Go files (see https://golang.org/s/generatedcode).
+func isGenerated(f *ast.File) bool {
+	for _, cgroup := range f.Comments {
+		if cgroup.Pos() >= f.Package {
+			break
+		}
+		for _, c := range cgroup.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") && strings.HasSuffix(c.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// funcName returns the name of the declared function, qualified by
+// the name of its receiver type if it is a method, such as "T.f".
+func funcName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	typ := decl.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if index, ok := typ.(*ast.IndexExpr); ok {
+		typ = index.X // a generic type
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name + "." + decl.Name.Name
+	}
+	return decl.Name.Name
+}
+
+// enclosingFile returns the syntax tree of the file of pass that
+// contains pos, or nil if there is none.
+func enclosingFile(pass *analysis.Pass, pos token.Pos) *ast.File {
+	for _, f := range pass.Files {
+		if tf := pass.Fset.File(f.Pos()); tf != nil && tf.Base() <= int(pos) && int(pos) <= tf.Base()+tf.Size() {
+			return f
+		}
+	}
+	return nil
+}
+
+// exportedOnly returns the diagnostics that are not within an
+// unexported declaration (see WithExportedOnly).
+func exportedOnly(pass *analysis.Pass, diagnostics []analysis.Diagnostic) []analysis.Diagnostic {
+	var kept []analysis.Diagnostic
+	for _, d := range diagnostics {
+		if exported, ok := enclosingDeclExported(pass, d.Pos); !ok || exported {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// enclosingDeclExported reports whether the top-level declaration that
+// encloses pos is exported, using type information if it is available.
+// It reports false for ok if pos is not within a declaration.
+func enclosingDeclExported(pass *analysis.Pass, pos token.Pos) (exported, ok bool) {
+	f := enclosingFile(pass, pos)
+	if f == nil {
+		return false, false
+	}
+	isExported := func(id *ast.Ident) bool {
+		if pass.TypesInfo != nil {
+			if obj := pass.TypesInfo.Defs[id]; obj != nil {
+				return obj.Exported()
+			}
+		}
+		return id.IsExported()
+	}
+	for _, decl := range f.Decls {
+		if pos < decl.Pos() || pos >= decl.End() {
+			continue
+		}
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if name := funcName(decl); strings.Contains(name, ".") && !ast.IsExported(name) {
+				return false, true // a method of an unexported type
+			}
+			return isExported(decl.Name), true
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if pos < spec.Pos() || pos >= spec.End() {
+					continue
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					return isExported(spec.Name), true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if isExported(name) {
+							return true, true
+						}
+					}
+					return false, true
+				}
+			}
+		}
+		return false, false
+	}
+	return false, false
+}
+
+// importLine returns the line of the import spec of path in the file of
+// the package of pass with the sanitized filename, or 0 if it has none.
+func importLine(pass *analysis.Pass, gopath, filename, path string) int {
+	for _, f := range pass.Files {
+		if sanitize(gopath, pass.Fset.Position(f.Pos()).Filename) != filename {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && p == path {
+				return pass.Fset.Position(spec.Pos()).Line
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,621 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/findcall"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// funcdecl reports each function declaration, at the whole
+// declaration if its name begins with "wide", or else at its name.
+var funcdecl = &analysis.Analyzer{
+	Name: "funcdecl",
+	Doc:  "report function declarations",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok {
+					var n ast.Node = decl.Name
+					if strings.HasPrefix(decl.Name.Name, "wide") {
+						n = decl
+					}
+					pass.Report(analysis.Diagnostic{
+						Pos:     n.Pos(),
+						End:     n.End(),
+						Message: decl.Name.Name,
+					})
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+func TestNarrowestNode(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func wideF() { // want "wideF"
+	println()
+}
+
+func narrowG() { // want "narrowG"
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNarrowestNode(1)).Run(t2, dir, funcdecl, "a")
+
+	want := []string{
+		`a/a.go:3:1: diagnostic "wideF" is reported at a *ast.FuncDecl spanning 3 lines; want at most 1`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNoFixes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	findcall.Analyzer.Flags.Set("name", "println")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printcall is advisory.
+	analysistest.NewRunner(analysistest.WithNoFixes()).Run(t, dir, printcall, "a")
+
+	// findcall is not.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNoFixes()).Run(t2, dir, findcall.Analyzer, "a")
+	want := []string{
+		`a/a.go:4:9: diagnostic "call of println(...)" has 1 suggested fixes; want none`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// twice reports each call of println twice, and each call of print once.
+var twice = &analysis.Analyzer{
+	Name: "twice",
+	Doc:  "report calls of println twice",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok {
+						pass.Reportf(call.Pos(), "call of %s", id.Name)
+						if id.Name == "println" {
+							pass.Reportf(call.Pos(), "call of %s", id.Name)
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestNoDuplicates(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want "call of println" "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Without the check, the duplicates are matched by 'want' comments.
+	analysistest.Run(t, dir, twice, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNoDuplicates()).Run(t2, dir, twice, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of println" is reported 2 times`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSuppressionDirective(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() //nolint // want none
+	//lint:ignore SA1000 reason
+	println() // want "call of println"
+	print()   // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printcall honors suppression comments on the same line only.
+	analysistest.NewRunner(analysistest.WithSuppression("//nolint", false)).Run(t, dir, printcall, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithSuppression("//lint:ignore", true)).Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:6:2: diagnostic "call of println" is reported on a line suppressed by //lint:ignore`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEmptyMessages(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want ""
+	print(1)  // want "^ $"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// blankcall forgets the message of some calls.
+	blankcall := &analysis.Analyzer{
+		Name: "blankcall",
+		Doc:  "report calls of print and println",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						switch {
+						case isIdent(call.Fun, "println"):
+							pass.Reportf(call.Pos(), "")
+						case len(call.Args) > 0:
+							pass.Reportf(call.Pos(), " ")
+						default:
+							pass.Reportf(call.Pos(), "call of print")
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, blankcall, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic has an empty message ""`,
+		`a/a.go:6:2: diagnostic has an empty message " "`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUTF8Messages(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+var (
+	s = "ok"   // want "string ok"
+	b = "\xff" // want "string"
+)
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// literals splices the values of string literals into its messages.
+	literals := &analysis.Analyzer{
+		Name: "literals",
+		Doc:  "report string literals",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						s, _ := strconv.Unquote(lit.Value)
+						pass.Reportf(lit.Pos(), "string %s", s)
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, literals, "a")
+	want := []string{
+		`a/a.go:5:6: diagnostic message "string \xff" is not valid UTF-8`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRequireCategory(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// removeprint categorizes its diagnostics.
+	analysistest.NewRunner(analysistest.RequireCategory()).Run(t, dir, removeprint, "a")
+
+	// printcall does not.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.RequireCategory()).Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:4:2: diagnostic "call of print" has no category`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// calleedecl reports each call of a function at the function's
+// declaration, even if it belongs to another package.
+var calleedecl = &analysis.Analyzer{
+	Name: "calleedecl",
+	Doc:  "report the declarations of called functions",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+						if fn, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Func); ok {
+							pass.Reportf(fn.Pos(), "called %s", fn.Name())
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestFindingsInPackage(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+import "b"
+
+func f() {
+	b.G()
+}
+`,
+		"b/b.go": `package b
+
+func G() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, calleedecl, "a")
+	want := []string{
+		`b/b.go:3:6: unexpected diagnostic: called G`,
+		`b/b.go:3:6: diagnostic "called G" is reported in a file that does not belong to package a`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without types, the package has no path.
+	parseb := &analysis.Analyzer{
+		Name: "parseb",
+		Doc:  "report the first declaration of package b",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			dir := filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+			f, err := parser.ParseFile(pass.Fset, filepath.Join(dir, "..", "b", "b.go"), nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			pass.Reportf(f.Decls[0].Pos(), "declaration of b")
+			return nil, nil
+		},
+	}
+	got = nil
+	analysistest.NewRunner(analysistest.WithSyntaxOnly()).Run(t2, dir, parseb, "a")
+	want = []string{
+		`b/b.go:3:1: unexpected diagnostic: declaration of b`,
+		`b/b.go:3:1: diagnostic "declaration of b" is reported in a file that does not belong to the package`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFindingsInLineDirectiveFile(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": "package a\n\n//" + "line orig/orig.go:3\nfunc f() {}\n\nfunc g() {\n//" + "line body/body.go:3\n\tprintln()\n}\n",
+		"a/orig/orig.go": `package orig
+
+func f() {}
+`,
+		"a/body/body.go": `package body
+
+func g() { println() }
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// reparse parses again the files to which parts of the package
+	// are mapped by //line directives, as the cgocall analyzer does for
+	// cgo sources, and reports their first declarations.
+	reparse := &analysis.Analyzer{
+		Name: "reparse",
+		Doc:  "report the first declaration of each original file",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			seen := make(map[string]bool)
+			for _, f := range pass.Files {
+				var err error
+				ast.Inspect(f, func(n ast.Node) bool {
+					if n == nil || err != nil {
+						return false
+					}
+					filename := pass.Fset.Position(n.Pos()).Filename
+					if filename == pass.Fset.File(f.Pos()).Name() || seen[filename] {
+						return true
+					}
+					seen[filename] = true
+					var orig *ast.File
+					orig, err = parser.ParseFile(pass.Fset, filename, nil, 0)
+					if err == nil {
+						pass.Reportf(orig.Decls[0].Pos(), "original declaration")
+					}
+					return true
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, reparse, "a")
+	want := []string{
+		`a/orig/orig.go:3:1: unexpected diagnostic: original declaration`,
+		`a/body/body.go:3:1: unexpected diagnostic: original declaration`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRegions(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+
+// BEGIN
+func g() {
+	print() // want "call of print"
+}
+// END
+
+func h() {
+	println() // want "call of println"
+}
+`,
+		"b/b.go": `package b
+
+// END
+
+// BEGIN
+func f() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Without WithRegions, the markers are ordinary comments.
+	analysistest.Run(t, dir, printcall, "a", "b")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithRegions()).Run(t2, dir, printcall, "a", "b")
+	want := []string{
+		`a/a.go:4:2: diagnostic "call of print" is reported outside the BEGIN and END markers of its file`,
+		`a/a.go:14:2: diagnostic "call of println" is reported outside the BEGIN and END markers of its file`,
+		`b/b.go:3:1: END marker without a BEGIN marker`,
+		`b/b.go:5:1: BEGIN marker without an END marker`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExportedOnly(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func F() {
+	print() // want "call of print"
+}
+
+func f() {
+	print()
+}
+
+type T int
+
+func (T) M() { print() } // want "call of print"
+
+func (T) m() { print() }
+
+type t int
+
+func (t) M() { print() }
+
+var (
+	V    = func() int { print(); return 0 }() // want "call of print"
+	v    = func() int { print(); return 0 }()
+	w, W = 0, func() int { print(); return 0 }() // want "call of print"
+)
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithExportedOnly()).Run(t, dir, printcall, "a")
+}
+
+func TestNoFindingsInText(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "print"
+	// see print() // want "print"
+	_ = "use print() to debug" // want "print"
+	_ = ` + "`print()`" + ` // want "print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printscan reports each occurrence of the text "print(" in the
+	// files of the package, including those in comments and strings.
+	printscan := &analysis.Analyzer{
+		Name: "printscan",
+		Doc:  "report the text print(",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				tf := pass.Fset.File(f.Pos())
+				content, err := ioutil.ReadFile(tf.Name())
+				if err != nil {
+					return nil, err
+				}
+				for i := 0; ; {
+					j := bytes.Index(content[i:], []byte("print("))
+					if j < 0 {
+						break
+					}
+					i += j
+					pass.Reportf(tf.Pos(i), "print")
+					i++
+				}
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNoFindingsInText()).Run(t2, dir, printscan, "a")
+	want := []string{
+		"a/a.go:5:9: diagnostic \"print\" is reported within the comment // see print() // want \"print\"",
+		"a/a.go:6:11: diagnostic \"print\" is reported within the literal \"use print() to debug\"",
+		"a/a.go:7:7: diagnostic \"print\" is reported within the literal `print()`",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// This file defines the reports written by WithTAPReport and
+// WithJUnitReport for continuous integration systems.
+
+// A testCase is the outcome of the test of the analysis of one package.
+// It records the errors that it forwards to the underlying Testing.
+type testCase struct {
+	Testing
+	analyzer string // the name of the analyzer
+	pkg      string // the ID of the package
+	errors   []string
+}
+
+func (tc *testCase) Errorf(format string, args ...interface{}) {
+	tc.errors = append(tc.errors, fmt.Sprintf(format, args...))
+	tc.Testing.Errorf(format, args...)
+}
+
+func (tc *testCase) Logf(format string, args ...interface{}) {
+	logf(tc.Testing, format, args...)
+}
+
+// writeTAP writes the outcomes of the cases to w in TAP format.
+func writeTAP(t Testing, w io.Writer, cases []*testCase) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "TAP version 13\n1..%d\n", len(cases))
+	for i, tc := range cases {
+		status := "ok"
+		if tc.errors != nil {
+			status = "not ok"
+		}
+		fmt.Fprintf(&buf, "%s %d - %s@%s\n", status, i+1, tc.analyzer, tc.pkg)
+		for _, err := range tc.errors {
+			for _, line := range strings.Split(err, "\n") {
+				fmt.Fprintf(&buf, "# %s\n", line)
+			}
+		}
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		t.Errorf("writing TAP report: %v", err)
+	}
+}
+
+// The types below define the subset of the JUnit XML format
+// that writeJUnit uses.
+type (
+	junitSuites struct {
+		XMLName xml.Name      `xml:"testsuites"`
+		Suites  []*junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string         `xml:"name,attr"`
+		ClassName string         `xml:"classname,attr"`
+		Failures  []junitFailure `xml:"failure"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// writeJUnit writes the outcomes of the cases to w in JUnit XML
+// format, with a test suite for each analyzer.
+func writeJUnit(t Testing, w io.Writer, cases []*testCase) {
+	var suites []*junitSuite
+	suiteOf := make(map[string]*junitSuite)
+	for _, tc := range cases {
+		suite := suiteOf[tc.analyzer]
+		if suite == nil {
+			suite = &junitSuite{Name: tc.analyzer}
+			suiteOf[tc.analyzer] = suite
+			suites = append(suites, suite)
+		}
+		jc := junitCase{Name: tc.pkg, ClassName: tc.analyzer}
+		for _, err := range tc.errors {
+			jc.Failures = append(jc.Failures, junitFailure{Message: strings.SplitN(err, "\n", 2)[0], Text: err})
+		}
+		suite.Tests++
+		if jc.Failures != nil {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, jc)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+	if err := enc.Encode(junitSuites{Suites: suites}); err != nil {
+		t.Errorf("encoding JUnit report: %v", err)
+		return
+	}
+	buf.WriteString("\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		t.Errorf("writing JUnit report: %v", err)
+	}
+}
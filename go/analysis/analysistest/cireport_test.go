@@ -0,0 +1,66 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestCIReports(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	print() // want "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var tap, junit bytes.Buffer
+	t2 := errorfunc(func(string) {})
+	analysistest.NewRunner(analysistest.WithTAPReport(&tap), analysistest.WithJUnitReport(&junit)).Run(t2, dir, printcall, "a", "b")
+
+	wantTAP := `TAP version 13
+1..2
+ok 1 - printcall@a
+not ok 2 - printcall@b
+# b/b.go:4:2: diagnostic "call of print" does not match pattern "call of println"
+# b/b.go:4: no diagnostic was reported matching "call of println"
+`
+	if got := tap.String(); got != wantTAP {
+		t.Errorf("got TAP report:\n%s\nwant:\n%s", got, wantTAP)
+	}
+
+	wantJUnit := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite name="printcall" tests="2" failures="1">
+		<testcase name="a" classname="printcall"></testcase>
+		<testcase name="b" classname="printcall">
+			<failure message="b/b.go:4:2: diagnostic &#34;call of print&#34; does not match pattern &#34;call of println&#34;">b/b.go:4:2: diagnostic &#34;call of print&#34; does not match pattern &#34;call of println&#34;</failure>
+			<failure message="b/b.go:4: no diagnostic was reported matching &#34;call of println&#34;">b/b.go:4: no diagnostic was reported matching &#34;call of println&#34;</failure>
+		</testcase>
+	</testsuite>
+</testsuites>
+`
+	if got := junit.String(); got != wantJUnit {
+		t.Errorf("got JUnit report:\n%s\nwant:\n%s", got, wantJUnit)
+	}
+}
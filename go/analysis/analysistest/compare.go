@@ -0,0 +1,355 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// This file defines helpers that check that an analyzer reports the
+// same diagnostics for two variants of the same packages.
+
+// CheckFormatStable checks that the analyzer reports the same
+// diagnostics, compared by message, for the packages denoted by
+// patterns in dir as for a copy of them formatted by gofmt. Since
+// formatting does not change the meaning of a program, a difference
+// indicates that the analyzer depends on incidental aspects of layout.
+// Positions are ignored, as formatting may change them.
+func CheckFormatStable(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	NewRunner().CheckFormatStable(t, dir, a, patterns...)
+}
+
+// CheckFormatStable behaves like the package-level CheckFormatStable
+// function, but uses the Runner's configuration.
+func (r *Runner) CheckFormatStable(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	formatted, cleanup, err := copyTree(dir, func(filename string, data []byte) []byte {
+		if strings.HasSuffix(filename, ".go") {
+			if src, err := format.Source(data); err == nil {
+				return src
+			}
+		}
+		return data
+	})
+	if err != nil {
+		t.Errorf("copying %s: %v", dir, err)
+		return
+	}
+	defer cleanup()
+
+	r.compareMessages(t, a, patterns, "the original", dir, "the formatted copy", formatted)
+}
+
+// CheckCommentStable checks that the analyzer reports the same
+// diagnostics, compared by message, for the packages denoted by
+// patterns in dir as for a copy of them from which comments have been
+// removed, other than directives such as //go:build and //go:noinline.
+// Since comments do not change the meaning of a program, a difference
+// indicates that the analyzer depends on them, for example on their
+// positions. An analyzer that legitimately reads comments, such as one
+// that honors suppression comments, is expected to fail the check.
+// Positions are ignored, as removing comments may change them.
+func CheckCommentStable(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	NewRunner().CheckCommentStable(t, dir, a, patterns...)
+}
+
+// CheckCommentStable behaves like the package-level CheckCommentStable
+// function, but uses the Runner's configuration.
+func (r *Runner) CheckCommentStable(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	stripped, cleanup, err := copyTree(dir, func(filename string, data []byte) []byte {
+		if strings.HasSuffix(filename, ".go") {
+			if src, err := stripComments(filename, data); err == nil {
+				return src
+			}
+		}
+		return data
+	})
+	if err != nil {
+		t.Errorf("copying %s: %v", dir, err)
+		return
+	}
+	defer cleanup()
+
+	r.compareMessages(t, a, patterns, "the original", dir, "the copy without comments", stripped)
+}
+
+// AssertSameFindings checks that the analyzer reports the same
+// diagnostics, compared by message, for the package pkg in the
+// directory dirA as in the directory dirB, each of which is the root
+// of a tree as for Run. It is intended for the maintenance of test
+// data: for example, it checks that a reformatted or renamed copy of a
+// package still exercises the analyzer in the same way. Each message
+// that is reported a different number of times in the two directories
+// is reported as an error. Positions are ignored.
+func AssertSameFindings(t Testing, a *analysis.Analyzer, dirA, dirB, pkg string) {
+	NewRunner().AssertSameFindings(t, a, dirA, dirB, pkg)
+}
+
+// AssertSameFindings behaves like the package-level AssertSameFindings
+// function, but uses the Runner's configuration.
+func (r *Runner) AssertSameFindings(t Testing, a *analysis.Analyzer, dirA, dirB, pkg string) {
+	r.compareMessages(t, a, []string{pkg}, dirA, dirA, dirB, dirB)
+}
+
+// CheckPlatformStable checks that the analyzer reports the same
+// diagnostics, compared by message, for the packages denoted by
+// patterns in dir when they are loaded for the operating system goos1
+// as for goos2, such as "linux" and "windows" (see WithGOOS). For an
+// analyzer that should not depend on the target platform, applied to
+// packages whose files are not platform-specific, a difference
+// indicates an accidental dependence, for example on the sizes of
+// types. Each difference is reported with the count of the message for
+// each platform.
+func CheckPlatformStable(t Testing, dir string, a *analysis.Analyzer, goos1, goos2 string, patterns ...string) {
+	NewRunner().CheckPlatformStable(t, dir, a, goos1, goos2, patterns...)
+}
+
+// CheckPlatformStable behaves like the package-level
+// CheckPlatformStable function, but uses the Runner's configuration,
+// except for its target operating system.
+func (r *Runner) CheckPlatformStable(t Testing, dir string, a *analysis.Analyzer, goos1, goos2 string, patterns ...string) {
+	r1, r2 := &Runner{cfg: r.cfg}, &Runner{cfg: r.cfg}
+	r1.cfg.goos, r2.cfg.goos = goos1, goos2
+	compareCounts(t,
+		"the "+goos1+" build", r1.countMessages(t, dir, a, patterns),
+		"the "+goos2+" build", r2.countMessages(t, dir, a, patterns))
+}
+
+// CheckDotImports checks that the analyzer reports the same
+// diagnostics, compared by message, for the packages denoted by
+// patterns in dir as for a copy of them in which each import is a dot
+// import, such as 'import . "fmt"', and each reference to an imported
+// name, such as fmt.Println, is unqualified. Since the copy has the same
+// meaning, a difference indicates that the analyzer identifies objects
+// by the syntax of references to them rather than by resolving them,
+// a common mistake. The packages must not declare, or import from two
+// packages, names that would then conflict; the name of an imported
+// package is assumed to be the last element of its path. Positions are
+// ignored, as the rewriting changes them.
+func CheckDotImports(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	NewRunner().CheckDotImports(t, dir, a, patterns...)
+}
+
+// CheckDotImports behaves like the package-level CheckDotImports
+// function, but uses the Runner's configuration.
+func (r *Runner) CheckDotImports(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	dotted, cleanup, err := copyTree(dir, func(filename string, data []byte) []byte {
+		if strings.HasSuffix(filename, ".go") {
+			if src, err := dotImports(filename, data); err == nil {
+				return src
+			}
+		}
+		return data
+	})
+	if err != nil {
+		t.Errorf("copying %s: %v", dir, err)
+		return
+	}
+	defer cleanup()
+
+	r.compareMessages(t, a, patterns, "the original", dir, "the copy with dot imports", dotted)
+}
+
+// dotImports returns the Go source file data, formatted, with each of
+// its imports made a dot import, and the references to their names
+// unqualified.
+func dotImports(filename string, data []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	dotted := make(map[string]bool) // names of the packages made dot imports
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" || name == "." || path == "C" || !isIdentifier(name) {
+			continue
+		}
+		spec.Name = &ast.Ident{NamePos: spec.Path.Pos(), Name: "."}
+		dotted[name] = true
+	}
+	astutil.Apply(f, func(c *astutil.Cursor) bool {
+		if sel, ok := c.Node().(*ast.SelectorExpr); ok {
+			// An unresolved identifier refers to a package
+			// (or a predeclared or dot-imported name).
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil && dotted[id.Name] {
+				c.Replace(sel.Sel)
+			}
+		}
+		return true
+	}, nil)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isIdentifier reports whether name is a Go identifier.
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != "" && !token.Lookup(name).IsKeyword()
+}
+
+// stripComments returns the Go source file data, formatted, without
+// its comments, except for directives.
+func stripComments(filename string, data []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*ast.CommentGroup
+	for _, cgroup := range f.Comments {
+		var list []*ast.Comment
+		for _, c := range cgroup.List {
+			if isDirective(c.Text) {
+				list = append(list, c)
+			}
+		}
+		if list != nil {
+			groups = append(groups, &ast.CommentGroup{List: list})
+		}
+	}
+	f.Comments = groups
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isDirective reports whether the comment text is a directive to a
+// tool, which may change the meaning of a program, such as //go:build,
+// // +build, //line, or //export.
+func isDirective(text string) bool {
+	for _, prefix := range []string{"//go:", "// +build", "//line ", "//export "} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// analyze loads the packages denoted by patterns in dir and applies
+// the analyzer to them, without checking any expectations.
+func (r *Runner) analyze(t Testing, dir string, a *analysis.Analyzer, patterns ...string) ([]*Result, error) {
+	pkgs, err := r.loadPackages(t, dir, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return r.testAnalyzer(t, dir, a, pkgs), nil
+}
+
+// compareMessages analyzes the packages denoted by patterns in each of
+// two directories, described by labels, and reports to t each
+// diagnostic message that is reported a different number of times
+// in a package of one directory than in the same package of the other.
+func (r *Runner) compareMessages(t Testing, a *analysis.Analyzer, patterns []string, label1, dir1, label2, dir2 string) {
+	compareCounts(t, label1, r.countMessages(t, dir1, a, patterns), label2, r.countMessages(t, dir2, a, patterns))
+}
+
+// countMessages analyzes the packages denoted by patterns in dir and
+// returns the number of times that each message is reported in each
+// package, or nil if loading failed.
+func (r *Runner) countMessages(t Testing, dir string, a *analysis.Analyzer, patterns []string) map[string]int {
+	results, err := r.analyze(t, dir, a, patterns...)
+	if err != nil {
+		t.Errorf("loading %s in %s: %v", patterns, dir, err)
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("error analyzing %s: %v", result.Package.ID, result.Err)
+			continue
+		}
+		for _, d := range result.Diagnostics {
+			counts[fmt.Sprintf("%s: diagnostic %q", result.Package.ID, d.Message)]++
+		}
+	}
+	return counts
+}
+
+// compareCounts reports to t each message whose counts (see
+// countMessages) differ between two analyses, described by labels.
+func compareCounts(t Testing, label1 string, counts1 map[string]int, label2 string, counts2 map[string]int) {
+	if counts1 == nil || counts2 == nil {
+		return
+	}
+
+	var errs []string
+	for k, n1 := range counts1 {
+		if n2 := counts2[k]; n1 != n2 {
+			errs = append(errs, fmt.Sprintf("%s was reported %d times in %s but %d times in %s", k, n1, label1, n2, label2))
+		}
+	}
+	for k, n2 := range counts2 {
+		if _, ok := counts1[k]; !ok {
+			errs = append(errs, fmt.Sprintf("%s was reported 0 times in %s but %d times in %s", k, label1, n2, label2))
+		}
+	}
+	sort.Strings(errs)
+	for _, err := range errs {
+		t.Errorf("%s", err)
+	}
+}
+
+// copyTree copies the tree rooted at dir to a new directory in TempDir,
+// applying transform to the contents of each file. On success it returns
+// the name of the new directory and a cleanup function to delete it.
+func copyTree(dir string, transform func(filename string, data []byte) []byte) (copy string, cleanup func(), err error) {
+	copy, err = ioutil.TempDir(TempDir, "analysistest")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(copy) }
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(copy, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, transform(path, data), 0666)
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return copy, cleanup, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// column reports each call expression, mentioning its column,
+// and so depends on the layout of the source.
+var column = &analysis.Analyzer{
+	Name: "column",
+	Doc:  "report calls and their columns",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					pass.Reportf(call.Pos(), "call at column %d", pass.Fset.Position(call.Pos()).Column)
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestFormatStable(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+    print()
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printcall does not depend on layout.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckFormatStable(t2, dir, printcall, "a")
+	if got != nil {
+		t.Errorf("printcall: got %q, want no errors", got)
+	}
+
+	// column does.
+	got = nil
+	analysistest.CheckFormatStable(t2, dir, column, "a")
+	want := []string{
+		`a: diagnostic "call at column 2" was reported 1 times in the original but 2 times in the formatted copy`,
+		`a: diagnostic "call at column 5" was reported 1 times in the original but 0 times in the formatted copy`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCommentStable(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+// f calls print.
+func f() {
+	print() // a call
+	println()
+}
+`,
+		"a/ignored.go": `//go:build ignore
+// +build ignore
+
+package a
+
+func g() {
+	print()
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	print() //nolint
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printcall does not depend on ordinary comments,
+	// and directives are kept.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckCommentStable(t2, dir, printcall, "a")
+	if got != nil {
+		t.Errorf("printcall: got %q, want no errors", got)
+	}
+
+	// But it honors suppression comments.
+	got = nil
+	analysistest.CheckCommentStable(t2, dir, printcall, "b")
+	want := []string{
+		`b: diagnostic "call of print" was reported 0 times in the original but 1 times in the copy without comments`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSameFindings(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dirA, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	dirB, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() { print() }
+
+func g() { println(); println() }
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.AssertSameFindings(t, printcall, dirA, dirA, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.AssertSameFindings(t2, printcall, dirA, dirB, "a")
+	want := []string{
+		`a: diagnostic "call of println" was reported 1 times in ` + dirA + ` but 2 times in ` + dirB,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPlatformStable(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+}
+`,
+		"a/a_windows.go": `package a
+
+func g() {
+	print()
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.CheckPlatformStable(t, dir, printcall, "linux", "darwin", "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckPlatformStable(t2, dir, printcall, "linux", "windows", "a")
+	want := []string{
+		`a: diagnostic "call of print" was reported 1 times in the linux build but 2 times in the windows build`,
+		`a: diagnostic "call of println" was reported 0 times in the linux build but 1 times in the windows build`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDotImports(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+import (
+	"fmt"
+	str "strings"
+)
+
+func f(fmt2 int) {
+	fmt.Println(str.ToUpper("x"))
+	fmt.Sprint()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// resolved identifies fmt.Println by resolving references.
+	resolved := &analysis.Analyzer{
+		Name: "resolved",
+		Doc:  "report calls of fmt.Println",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						var id *ast.Ident
+						switch fun := call.Fun.(type) {
+						case *ast.Ident:
+							id = fun
+						case *ast.SelectorExpr:
+							id = fun.Sel
+						}
+						if fn, ok := pass.TypesInfo.Uses[id].(*types.Func); ok && fn.FullName() == "fmt.Println" {
+							pass.Reportf(call.Pos(), "call of fmt.Println")
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	analysistest.CheckDotImports(t, dir, resolved, "a")
+
+	// syntactic identifies it by its syntax.
+	syntactic := &analysis.Analyzer{
+		Name: "syntactic",
+		Doc:  "report calls of fmt.Println",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if sel, ok := n.(*ast.SelectorExpr); ok && isIdent(sel.X, "fmt") && sel.Sel.Name == "Println" {
+						pass.Reportf(sel.Pos(), "call of fmt.Println")
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckDotImports(t2, dir, syntactic, "a")
+	want := []string{
+		`a: diagnostic "call of fmt.Println" was reported 1 times in the original but 0 times in the copy with dot imports`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A Coverage records which parts of the packages under test an
+// analyzer covered: the positions of the diagnostics it reported, and
+// the syntax nodes that enclose them. It allows a test to check that an
+// analyzer is complete, for example that it reports within the methods
+// of a type as well as its functions. See WithCoverage.
+//
+// The coverage is derived from the diagnostics alone: a node that the
+// analyzer examined without reporting anything within it is not
+// recorded.
+type Coverage struct {
+	mu        sync.Mutex
+	dir       string // the directory of the packages under test
+	enclosing map[reflect.Type][]token.Position
+	reported  []token.Position
+}
+
+// Enclosing returns the positions of the nodes of the same type as
+// kind, such as (*ast.FuncDecl)(nil), that enclose a diagnostic reported
+// by the analyzer, in order, in the form "file:line:col", with file
+// names relative to the directory of the packages under test. A node
+// that encloses several diagnostics appears once.
+func (c *Coverage) Enclosing(kind ast.Node) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.format(c.enclosing[reflect.TypeOf(kind)])
+}
+
+// Reported returns the positions of the diagnostics reported by the
+// analyzer, in the same form as Enclosing.
+func (c *Coverage) Reported() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.format(c.reported)
+}
+
+// reset prepares c to record the analysis of the packages in dir.
+func (c *Coverage) reset(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.enclosing = make(map[reflect.Type][]token.Position)
+	c.reported = nil
+}
+
+// report records the positions of the diagnostics of pass, and of
+// the nodes of the files of pass that enclose them.
+func (c *Coverage) report(pass *analysis.Pass, diagnostics []analysis.Diagnostic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range diagnostics {
+		c.reported = append(c.reported, pass.Fset.Position(d.Pos))
+		end := d.End
+		if !end.IsValid() {
+			end = d.Pos
+		}
+		for _, f := range pass.Files {
+			if tf := pass.Fset.File(f.Pos()); tf.Base() <= int(d.Pos) && int(d.Pos) <= tf.Base()+tf.Size() {
+				path, _ := astutil.PathEnclosingInterval(f, d.Pos, end)
+				for _, n := range path {
+					typ := reflect.TypeOf(n)
+					c.enclosing[typ] = append(c.enclosing[typ], pass.Fset.Position(n.Pos()))
+				}
+				break
+			}
+		}
+	}
+}
+
+// format returns the sorted, distinct positions of posns as strings.
+func (c *Coverage) format(posns []token.Position) []string {
+	sorted := make([]token.Position, len(posns))
+	copy(sorted, posns)
+	sort.Slice(sorted, func(i, j int) bool {
+		x, y := sorted[i], sorted[j]
+		if x.Filename != y.Filename {
+			return x.Filename < y.Filename
+		}
+		if x.Line != y.Line {
+			return x.Line < y.Line
+		}
+		return x.Column < y.Column
+	})
+	var strs []string
+	for i, posn := range sorted {
+		if i > 0 && posn == sorted[i-1] {
+			continue
+		}
+		strs = append(strs, fmt.Sprintf("%s:%d:%d", sanitize(c.dir, posn.Filename), posn.Line, posn.Column))
+	}
+	return strs
+}
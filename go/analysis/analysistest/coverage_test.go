@@ -0,0 +1,74 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// baddecl reports each function declaration whose name begins with
+// "bad", using the inspector.
+var baddecl = &analysis.Analyzer{
+	Name:     "baddecl",
+	Doc:      "report bad function declarations",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+		inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+			decl := n.(*ast.FuncDecl)
+			if strings.HasPrefix(decl.Name.Name, "bad") {
+				pass.Reportf(decl.Name.Pos(), "bad function %s", decl.Name.Name)
+			}
+		})
+		return nil, nil
+	},
+}
+
+func TestCoverage(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func good() {
+	println()
+}
+
+func badF() {} // want "bad function badF"
+
+type T int
+
+func (T) badM() {} // want "bad function badM"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	cov := new(analysistest.Coverage)
+	analysistest.NewRunner(analysistest.WithCoverage(cov)).Run(t, dir, baddecl, "a")
+
+	for _, test := range []struct {
+		got, want []string
+	}{
+		{cov.Enclosing((*ast.FuncDecl)(nil)), []string{"a/a.go:7:1", "a/a.go:11:1"}},
+		{cov.Enclosing((*ast.CallExpr)(nil)), nil},
+		{cov.Reported(), []string{"a/a.go:7:6", "a/a.go:11:10"}},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
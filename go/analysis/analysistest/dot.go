@@ -0,0 +1,63 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// DotGraph returns a description, in the Graphviz DOT language, of the
+// graph of the specified analyzers and all those they require,
+// directly or indirectly. Each edge from an analyzer to one that it
+// requires is labeled by the type of the required analyzer's result,
+// and each analyzer that uses facts is labeled by their types.
+//
+// DotGraph is intended as an aid to debugging the ordering of
+// multi-analyzer configurations; its output may be rendered by
+// the Graphviz dot command.
+func DotGraph(analyzers []*analysis.Analyzer) string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph analyzers {\n")
+
+	seen := make(map[*analysis.Analyzer]bool)
+	var visit func(a *analysis.Analyzer)
+	visit = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+
+		if len(a.FactTypes) > 0 {
+			var facts []string
+			for _, f := range a.FactTypes {
+				facts = append(facts, reflect.TypeOf(f).String())
+			}
+			fmt.Fprintf(&buf, "\t%q [label=%q];\n", a.Name, a.Name+"\nfacts: "+strings.Join(facts, ", "))
+		} else {
+			fmt.Fprintf(&buf, "\t%q;\n", a.Name)
+		}
+		for _, req := range a.Requires {
+			if req.ResultType != nil {
+				fmt.Fprintf(&buf, "\t%q -> %q [label=%q];\n", a.Name, req.Name, req.ResultType.String())
+			} else {
+				fmt.Fprintf(&buf, "\t%q -> %q;\n", a.Name, req.Name)
+			}
+		}
+		for _, req := range a.Requires {
+			visit(req)
+		}
+	}
+	for _, a := range analyzers {
+		visit(a)
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/findcall"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+)
+
+func TestDotGraph(t *testing.T) {
+	a := &analysis.Analyzer{
+		Name:     "a",
+		Doc:      "a",
+		Requires: []*analysis.Analyzer{inspect.Analyzer, findcall.Analyzer},
+	}
+	got := analysistest.DotGraph([]*analysis.Analyzer{a, inspect.Analyzer})
+	want := `digraph analyzers {
+	"a";
+	"a" -> "inspect" [label="*inspector.Inspector"];
+	"a" -> "findcall";
+	"inspect";
+	"findcall" [label="findcall\nfacts: *findcall.foundFact"];
+}
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
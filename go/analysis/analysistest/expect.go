@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import "regexp"
+
+// An Expectation is the parsed form of a 'want' comment, whose grammar
+// is described at Run.
+type Expectation struct {
+	// LineDelta is the offset, specified by "+N", from the line of the
+	// comment to the line to which its expectations apply.
+	LineDelta int
+
+	// Expects holds the expectations of the comment, in order.
+	Expects []Expect
+}
+
+// An Expect is a single expectation of a 'want' comment.
+type Expect struct {
+	// Kind is "diagnostic", "fact", "compile-error", "last", "none", or
+	// "once".
+	Kind string
+
+	// Name is the name of the object to which a fact belongs,
+	// or "package" for a package fact. It is set only for facts.
+	Name string
+
+	// Patterns holds the pattern that a message must match, or each
+	// of the alternative patterns of an 'any:"rx"...' expectation.
+	// It is nil for 'none', 'prefix:"text"', 'code:"code"', and
+	// 'sprintf:"format" args...'.
+	Patterns []*regexp.Regexp
+
+	// Text is the exact message of a 'sprintf:"format" args...'
+	// expectation, the result of formatting its args, the prefix
+	// of the message of a 'prefix:"text"' expectation, the code
+	// of the message of a 'code:"code"' expectation, or the rule ID
+	// of the message of an 'id:R1234' expectation.
+	Text string
+
+	// Prefix reports whether Text is only a prefix of the message.
+	Prefix bool
+
+	// Code reports whether Text is the code of the message,
+	// for a 'code:"code"' expectation.
+	Code bool
+
+	// ID reports whether Text is the rule ID of the message,
+	// for an 'id:R1234' expectation.
+	ID bool
+
+	// Covers is the source text that the range of the diagnostic
+	// must span, for a 'covers:"text" "pattern"' expectation.
+	Covers string
+
+	// URL is the documentation URL that the diagnostic must have,
+	// for an expectation followed by 'url:"url"'.
+	URL string
+
+	// InFunc is the name of the function whose body must contain
+	// the diagnostic, for an 'infunc:"name" "pattern"' expectation.
+	InFunc string
+
+	// InFile is "generated" or "normal", the kind of file that must
+	// contain the diagnostic, for an 'ingenerated "pattern"' or
+	// 'innormal "pattern"' expectation.
+	InFile string
+
+	// Import is the path of the import spec on whose line the
+	// diagnostic must be, for an 'import:"path" "pattern"' expectation.
+	Import string
+
+	// Tolerance is the number of lines before or after its line on
+	// which the diagnostic may be, for a comment that begins with '~N'.
+	Tolerance int
+}
+
+// anyIDPattern is the rule ID pattern with which ParseExpectation
+// parses id: expectations.
+var anyIDPattern = regexp.MustCompile(`.*`)
+
+// ParseExpectation parses the text of a 'want' comment that follows
+// the word "want", such as ` "diag" x:"fact"`, as Run does with its
+// default configuration, except that it also accepts 'id:R1234'
+// expectations, which Run accepts only with WithIDPattern. It allows
+// tools to reuse the grammar of 'want' comments, for example to rewrite
+// or validate test data.
+func ParseExpectation(text string) (Expectation, error) {
+	// The pattern of id: expectations is not part of an Expect,
+	// so any will do.
+	cfg := &config{idPattern: anyIDPattern}
+	lineDelta, expects, err := parseExpectations(cfg, text)
+	if err != nil {
+		return Expectation{}, err
+	}
+	result := Expectation{LineDelta: lineDelta}
+	for _, exp := range expects {
+		e := Expect{Kind: exp.kind, Name: exp.name, Text: exp.text, Prefix: exp.prefix, Code: exp.code != nil, ID: exp.id != nil, Covers: exp.covers, URL: exp.url, InFunc: exp.infunc, InFile: exp.infile, Import: exp.importPath, Tolerance: exp.tolerance}
+		if exp.alts != nil {
+			e.Patterns = exp.alts
+		} else if exp.rx != nil {
+			e.Patterns = []*regexp.Regexp{exp.rx}
+		}
+		result.Expects = append(result.Expects, e)
+	}
+	return result, nil
+}
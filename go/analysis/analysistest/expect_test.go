@@ -0,0 +1,154 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestParseExpectation(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want string // formatted expectation, or error
+	}{
+		{``, `+0`},
+		{` "diag"`, `+0 diagnostic["diag"]`},
+		{"`raw \\d`", `+0 diagnostic["raw \\d"]`},
+		{`+2 "a" "b"`, `+2 diagnostic["a"] diagnostic["b"]`},
+		{`x:"fact1" x:"fact2" package:"pfact"`, `+0 fact x["fact1"] fact x["fact2"] fact package["pfact"]`},
+		{`"diag" x:"fact"`, `+0 diagnostic["diag"] fact x["fact"]`},
+		{`any:"a" "b" x:"fact"`, `+0 diagnostic["a" "b"] fact x["fact"]`},
+		{`sprintf:"%s %d %g" x 1 2.5`, `+0 diagnostic="x 1 2.5"`},
+		{`sprintf:"%q" x y:"fact"`, `+0 diagnostic="\"x\"" fact y["fact"]`},
+		{`sprintf:"%s" x "diag"`, `+0 diagnostic="x" diagnostic["diag"]`},
+		{`prefix:"unused (" "diag"`, `+0 diagnostic^="unused (" diagnostic["diag"]`},
+		{`covers:"x" "unused"`, `+0 diagnostic["unused"] covers "x"`},
+		{`code:"SA1000"`, `+0 diagnostic code "SA1000"`},
+		{`infunc:"T.f" "diag"`, `+0 diagnostic["diag"] in T.f`},
+		{`~2 "diag" x:"fact"`, `+0 diagnostic["diag"] ~2 fact x["fact"]`},
+		{`import:"fmt" "diag"`, `+0 diagnostic["diag"] import "fmt"`},
+		{`ingenerated "diag" innormal "diag2"`, `+0 diagnostic["diag"] in generated diagnostic["diag2"] in normal`},
+		{`"diag" url:"https://x" "diag2"`, `+0 diagnostic["diag"] url "https://x" diagnostic["diag2"]`},
+		{`compile-error "undefined" "diag"`, `+0 compile-error["undefined"] diagnostic["diag"]`},
+		{`none`, `+0 none`},
+		{`once "p"`, `+0 once["p"]`},
+		{`last "p" "diag"`, `+0 last["p"] diagnostic["diag"]`},
+		{`none:"fact"`, `+0 fact none["fact"]`},
+		{`id:R1 "diag"`, `+0 diagnostic id "R1" diagnostic["diag"]`},
+
+		// errors
+		{`"unterminated`, `error: literal not terminated`},
+		{`+x`, `error: got +Ident, want +Int`},
+		{`x "fact"`, `error: got String after x, want ':'`},
+		{`x:1`, `error: got Int, want regular expression`},
+		{`"("`, "error: error parsing regexp: missing closing ): `(`"},
+		{`1`, `error: unexpected Int`},
+		{`none "diag"`, `error: none cannot be combined with other expectations`},
+		{`any:`, `error: got EOF, want regular expression`},
+		{`sprintf:x`, `error: got Ident after sprintf:, want format string`},
+		{`once`, `error: got EOF, want regular expression`},
+		{`last "a" last "b"`, `error: a line has only one last diagnostic`},
+		{`prefix:x`, `error: got Ident after prefix:, want string`},
+		{`id:"fact"`, `+0 fact id["fact"]`},
+		{`compile-warning "x"`, `error: got compile-warning, want compile-error`},
+		{`code:x`, `error: got Ident after code:, want string`},
+		{`covers:x`, `error: got Ident after covers:, want string`},
+		{`covers:"x"`, `error: got EOF, want regular expression`},
+		{`infunc:f`, `error: got Ident after infunc:, want string`},
+		{`import:fmt`, `error: got Ident after import:, want string`},
+		{`~x "diag"`, `error: got ~Ident, want ~Int`},
+		{`url:"https://x"`, `error: url: must follow a diagnostic expectation`},
+		{`"diag" url:x`, `error: got Ident after url:, want string`},
+	} {
+		exp, err := analysistest.ParseExpectation(test.text)
+		var got string
+		if err != nil {
+			got = "error: " + err.Error()
+		} else {
+			got = formatExpectation(exp)
+		}
+		if got != test.want {
+			t.Errorf("ParseExpectation(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
+
+// formatExpectation returns a compact form of exp for comparison.
+func formatExpectation(exp analysistest.Expectation) string {
+	parts := []string{fmt.Sprintf("+%d", exp.LineDelta)}
+	for _, e := range exp.Expects {
+		s := e.Kind
+		if e.Name != "" {
+			s += " " + e.Name
+		}
+		if e.Patterns != nil {
+			var patterns []string
+			for _, rx := range e.Patterns {
+				patterns = append(patterns, fmt.Sprintf("%q", rx))
+			}
+			s += "[" + strings.Join(patterns, " ") + "]"
+		} else if e.Code {
+			s += fmt.Sprintf(" code %q", e.Text)
+		} else if e.ID {
+			s += fmt.Sprintf(" id %q", e.Text)
+		} else if e.Prefix {
+			s += fmt.Sprintf("^=%q", e.Text)
+		} else if e.Kind == "diagnostic" {
+			s += fmt.Sprintf("=%q", e.Text)
+		}
+		if e.Covers != "" {
+			s += fmt.Sprintf(" covers %q", e.Covers)
+		}
+		if e.URL != "" {
+			s += fmt.Sprintf(" url %q", e.URL)
+		}
+		if e.InFunc != "" {
+			s += fmt.Sprintf(" in %s", e.InFunc)
+		}
+		if e.InFile != "" {
+			s += fmt.Sprintf(" in %s", e.InFile)
+		}
+		if e.Import != "" {
+			s += fmt.Sprintf(" import %q", e.Import)
+		}
+		if e.Tolerance != 0 {
+			s += fmt.Sprintf(" ~%d", e.Tolerance)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// TestParseExpectationID tests that ParseExpectation, which has no
+// WithIDPattern, accepts an id: expectation of any rule ID, and
+// represents it, unlike an id:"rx" fact expectation, as an ID.
+func TestParseExpectationID(t *testing.T) {
+	for _, id := range []string{"R1234", "1234", "SA1000", "x"} {
+		exp, err := analysistest.ParseExpectation(" id:" + id)
+		if err != nil {
+			t.Errorf("ParseExpectation(%q) failed: %v", " id:"+id, err)
+			continue
+		}
+		if len(exp.Expects) != 1 {
+			t.Errorf("ParseExpectation(%q) = %s, want one expectation", " id:"+id, formatExpectation(exp))
+			continue
+		}
+		if e := exp.Expects[0]; e.Kind != "diagnostic" || !e.ID || e.Text != id || e.Code || e.Patterns != nil {
+			t.Errorf("ParseExpectation(%q) = %+v, want diagnostic with ID %q", " id:"+id, e, id)
+		}
+	}
+
+	exp, err := analysistest.ParseExpectation(` id:"fact"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := exp.Expects[0]; e.Kind != "fact" || e.ID {
+		t.Errorf(`ParseExpectation(" id:\"fact\"") = %+v, want fact of id`, e)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// CheckFacts checks that the set of objects for which facts of the
+// same type as fact were exported, across all the results of a run
+// over the project in dir, is exactly the set described by want.
+//
+// Each element of want describes one object by its declaring position
+// and name, in the form "file:line: name", where file is relative to
+// the root of the project (for example, "a/b.go:3: f"). Package facts
+// are described by the name "package" and line 1 of the first source
+// file of the package, as in 'want' comments.
+//
+// Unlike the per-line fact expectations of Run, which tolerate the
+// absence of a fact where no expectation mentions it, CheckFacts reports
+// every missing and every unexpected fact to t, making it suitable for
+// facts that must be neither over- nor under-applied.
+func CheckFacts(t Testing, dir string, results []*Result, fact analysis.Fact, want ...string) {
+	typ := reflect.TypeOf(fact)
+
+	got := make(map[string]bool)
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		pass := result.Pass
+		for obj, facts := range result.Facts {
+			for _, f := range facts {
+				if reflect.TypeOf(f) != typ {
+					continue
+				}
+				var posn token.Position
+				var name string
+				if obj != nil {
+					name = obj.Name()
+					posn = pass.Fset.Position(obj.Pos())
+				} else {
+					name = "package"
+					posn = pass.Fset.Position(pass.Files[0].Pos())
+					posn.Line = 1
+				}
+				got[fmt.Sprintf("%s:%d: %s", sanitize(dir, posn.Filename), posn.Line, name)] = true
+			}
+		}
+	}
+
+	wantSet := make(map[string]bool)
+	for _, w := range want {
+		wantSet[w] = true
+	}
+
+	var errs []string
+	for w := range wantSet {
+		if !got[w] {
+			errs = append(errs, fmt.Sprintf("%s: no %v fact was exported", w, typ))
+		}
+	}
+	for g := range got {
+		if !wantSet[g] {
+			errs = append(errs, fmt.Sprintf("%s: unexpected %v fact was exported", g, typ))
+		}
+	}
+	sort.Strings(errs)
+	for _, err := range errs {
+		t.Errorf("%s", err)
+	}
+}
+
+// A factExport identifies the facts of one type that one pass
+// exported for an object, or for its package if obj is nil.
+type factExport struct {
+	pass *analysis.Pass
+	obj  types.Object
+	typ  reflect.Type
+}
+
+// factExports counts the exports of facts during an analysis.
+type factExports struct {
+	mu     sync.Mutex
+	order  []factExport
+	counts map[factExport]int
+}
+
+func (e *factExports) record(pass *analysis.Pass, obj types.Object, fact analysis.Fact) {
+	k := factExport{pass, obj, reflect.TypeOf(fact)}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[factExport]int)
+	}
+	if e.counts[k] == 0 {
+		e.order = append(e.order, k)
+	}
+	e.counts[k]++
+}
+
+// checkDuplicates reports each fact of the results that was exported
+// more than once for the same object.
+func (e *factExports) checkDuplicates(t Testing, dir string, results []*Result) {
+	passes := make(map[*analysis.Pass]bool)
+	for _, result := range results {
+		passes[result.Pass] = true
+	}
+	for _, k := range e.order {
+		n := e.counts[k]
+		if n < 2 || !passes[k.pass] {
+			continue
+		}
+		if k.obj != nil {
+			posn := k.pass.Fset.Position(k.obj.Pos())
+			posn.Filename = sanitize(dir, posn.Filename)
+			t.Errorf("%v: %v fact for %s was exported %d times", posn, k.typ, k.obj.Name(), n)
+		} else {
+			posn := k.pass.Fset.Position(k.pass.Files[0].Pos())
+			t.Errorf("%s:1: %v fact for package %s was exported %d times", sanitize(dir, posn.Filename), k.typ, k.pass.Pkg.Path(), n)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/findcall"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestCheckFacts(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	findcall.Analyzer.Flags.Set("name", "println")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a // want package:"found"
+
+func println(...interface{}) {} // want println:"found"
+
+func print(...interface{}) {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	results := analysistest.Run(t, dir, findcall.Analyzer, "a")
+	found := findcall.Analyzer.FactTypes[0]
+
+	// The exact set is accepted.
+	analysistest.CheckFacts(t, dir, results, found, "a/a.go:1: package", "a/a.go:3: println")
+
+	// Missing and spurious facts are both reported.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckFacts(t2, dir, results, found, "a/a.go:1: package", "a/a.go:5: print")
+	want := []string{
+		`a/a.go:3: println: unexpected *findcall.foundFact fact was exported`,
+		`a/a.go:5: print: no *findcall.foundFact fact was exported`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// A badFact marks a function as bad.
+type badFact struct{}
+
+func (*badFact) AFact()         {}
+func (*badFact) String() string { return "bad" }
+
+// badcall exports a badFact for each function whose name begins with
+// "Bad", and reports each call of a function with a badFact.
+var badcall = &analysis.Analyzer{
+	Name:      "badcall",
+	Doc:       "report calls of bad functions",
+	FactTypes: []analysis.Fact{new(badFact)},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					if strings.HasPrefix(n.Name.Name, "Bad") {
+						pass.ExportObjectFact(pass.TypesInfo.Defs[n.Name], new(badFact))
+					}
+				case *ast.SelectorExpr:
+					if fn, ok := pass.TypesInfo.Uses[n.Sel].(*types.Func); ok && pass.ImportObjectFact(fn, new(badFact)) {
+						pass.Reportf(n.Pos(), "call of bad function %s", fn.Name())
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestImportedFact(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func Bad() {}
+
+func Good() {}
+`,
+		"b/b.go": `package b
+
+import "a"
+
+func f() {
+	a.Bad() // want "call of bad function Bad"
+	a.Good()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, badcall, "b")
+
+	// With a supplied fact, badcall is not applied to package a.
+	dir, cleanup, err = analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func Bad() {}
+
+func Good() {}
+`,
+		"b/b.go": `package b
+
+import "a"
+
+func f() {
+	a.Bad()
+	a.Good() // want "call of bad function Good"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithImportedFact("a", "Good", new(badFact))).Run(t, dir, badcall, "b")
+
+	// A fact about a missing object is an error.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithImportedFact("a", "Missing", new(badFact))).Run(t2, dir, badcall, "b")
+	want := []string{
+		`package a has no object Missing for imported *analysistest_test.badFact fact`,
+		`b/b.go:7: no diagnostic was reported matching "call of bad function Good"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNoDuplicateFacts(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a // want package:"bad"
+
+func BadOnce() {} // want BadOnce:"bad"
+
+func BadTwice() {} // want BadTwice:"bad"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// twicefact exports a badFact for each function whose name
+	// begins with "Bad", twice if it ends with "Twice", and a
+	// package badFact twice.
+	twicefact := &analysis.Analyzer{
+		Name:      "twicefact",
+		Doc:       "export facts twice",
+		FactTypes: []analysis.Fact{new(badFact)},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			pass.ExportPackageFact(new(badFact))
+			pass.ExportPackageFact(new(badFact))
+			for _, f := range pass.Files {
+				for _, decl := range f.Decls {
+					if decl, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(decl.Name.Name, "Bad") {
+						pass.ExportObjectFact(pass.TypesInfo.Defs[decl.Name], new(badFact))
+						if strings.HasSuffix(decl.Name.Name, "Twice") {
+							pass.ExportObjectFact(pass.TypesInfo.Defs[decl.Name], new(badFact))
+						}
+					}
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	// By default, the duplicates are invisible.
+	analysistest.Run(t, dir, twicefact, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithNoDuplicateFacts()).Run(t2, dir, twicefact, "a")
+	want := []string{
+		`a/a.go:1: *analysistest_test.badFact fact for package a was exported 2 times`,
+		`a/a.go:5:6: *analysistest_test.badFact fact for BadTwice was exported 2 times`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
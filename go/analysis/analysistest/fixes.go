@@ -0,0 +1,271 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/internal/lsp/diff"
+	"golang.org/x/tools/internal/lsp/diff/myers"
+)
+
+// CheckFixesIdempotent checks that the suggested fixes of an analyzer
+// resolve the problems they address. It applies the analyzer to the
+// packages denoted by patterns in dir, applies the first suggested fix
+// of each diagnostic, reloads the fixed packages, and applies the
+// analyzer again. Each diagnostic of the second analysis with the same
+// category and message as a fixed diagnostic of the first in the same
+// file indicates a fix that is bad or incomplete, and is reported as an
+// error, whether or not it still has a suggested fix. Lines are not
+// compared, as the fixes may insert or delete lines. 'want' comments
+// are not checked.
+//
+// The test data is not modified: the fixed files are loaded as an
+// overlay (see WithOverlay).
+func CheckFixesIdempotent(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	NewRunner().CheckFixesIdempotent(t, dir, a, patterns...)
+}
+
+// CheckFixesIdempotent behaves like the package-level
+// CheckFixesIdempotent function, but uses the Runner's configuration.
+func (r *Runner) CheckFixesIdempotent(t Testing, dir string, a *analysis.Analyzer, patterns ...string) {
+	results, err := r.analyze(t, dir, a, patterns...)
+	if err != nil {
+		t.Errorf("loading %s: %v", patterns, err)
+		return
+	}
+	fixed, err := r.applyFixes(dir, results)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if len(fixed) == 0 {
+		return // nothing to fix
+	}
+
+	// A fixedKey identifies the kind of a fixed diagnostic
+	// in a file across the analyses.
+	type fixedKey struct {
+		category, message string
+		filename          string
+	}
+	keyOf := func(result *Result, d analysis.Diagnostic) fixedKey {
+		return fixedKey{d.Category, d.Message, result.Package.Fset.Position(d.Pos).Filename}
+	}
+	fixedKeys := make(map[fixedKey]bool)
+	for _, result := range results {
+		for _, d := range r.cfg.filter(result.Diagnostics) {
+			if len(d.SuggestedFixes) > 0 {
+				fixedKeys[keyOf(result, d)] = true
+			}
+		}
+	}
+
+	r2 := &Runner{cfg: r.cfg}
+	overlay := make(map[string]string)
+	for filename, content := range fixed {
+		overlay[sanitize(dir, filename)] = string(content)
+	}
+	WithOverlay(overlay).set(&r2.cfg)
+	results, err = r2.analyze(t, dir, a, patterns...)
+	if err != nil {
+		t.Errorf("loading %s after applying suggested fixes: %v", patterns, err)
+		return
+	}
+
+	// A file may appear in more than one package.
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("error analyzing %s after applying suggested fixes: %v", result.Package.ID, result.Err)
+			continue
+		}
+		for _, d := range r.cfg.filter(result.Diagnostics) {
+			if !fixedKeys[keyOf(result, d)] {
+				continue
+			}
+			posn := result.Package.Fset.Position(d.Pos)
+			if !inDir(dir, posn.Filename) {
+				continue
+			}
+			posn.Filename = sanitize(dir, posn.Filename)
+			msg := fmt.Sprintf("%v: diagnostic %q is still reported after applying suggested fixes", posn, d.Message)
+			if !seen[msg] {
+				seen[msg] = true
+				t.Errorf("%s", msg)
+			}
+		}
+	}
+}
+
+// RunWithPackageFixes behaves like Run, but additionally verifies the
+// result of applying the suggested fixes of all the diagnostics to the
+// packages at once, as a user does with a command to apply all fixes.
+// Unlike RunWithSuggestedFixes, which applies fixes file by file, it
+// detects conflicts between the fixes of different diagnostics.
+//
+// It applies the first suggested fix of each diagnostic, and compares
+// each changed file with its golden file, whose name is that of the
+// file with the suffix ".golden", and which contains plain Go source,
+// as formatted by gofmt. A file may appear in more than one package,
+// such as a package and its test variant; identical edits to it are
+// applied once. Overlapping edits of different diagnostics are
+// reported as an error, with the positions of both diagnostics, and
+// then no file is compared. As RunWithSuggestedFixes does, it reports
+// each edit of a fix that is out of source order.
+func RunWithPackageFixes(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	return NewRunner().RunWithPackageFixes(t, dir, a, patterns...)
+}
+
+// RunWithPackageFixes behaves like the package-level
+// RunWithPackageFixes function, but uses the Runner's configuration.
+func (r *Runner) RunWithPackageFixes(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	results := r.Run(t, dir, a, patterns...)
+	for _, result := range results {
+		for _, d := range r.cfg.filter(result.Diagnostics) {
+			for _, sf := range d.SuggestedFixes {
+				checkEditOrder(t, dir, result.Package.Fset, sf)
+			}
+		}
+	}
+	fixed, err := r.applyFixes(dir, results)
+	if err != nil {
+		t.Errorf("%v", err)
+		return results
+	}
+	var filenames []string
+	for filename := range fixed {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		name := sanitize(dir, filename)
+		want, err := ioutil.ReadFile(filename + ".golden")
+		if err != nil {
+			t.Errorf("error reading %s.golden: %v", name, err)
+			continue
+		}
+		got, err := format.Source(fixed[filename])
+		if err != nil {
+			t.Errorf("%s: applying suggested fixes produces invalid code: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			d, err := myers.ComputeEdits("", string(want), string(got))
+			if err != nil {
+				t.Errorf("failed to compute edits: %s", err)
+			}
+			t.Errorf("suggested fixes failed for %s:\n%s", name, diff.ToUnified(name+".golden", "actual", string(want), d))
+		}
+	}
+	return results
+}
+
+// inDir reports whether the named file is within the tree rooted at dir.
+func inDir(dir, filename string) bool {
+	return strings.HasPrefix(filename, dir+string(os.PathSeparator))
+}
+
+// An offsetEdit is a TextEdit whose range is expressed as byte offsets.
+type offsetEdit struct {
+	start, end int
+	newText    string
+
+	posn string // position of the diagnostic, relative to dir
+	fix  string // message of the suggested fix
+}
+
+// applyFixes applies the first suggested fix of each diagnostic of the
+// results, and returns the new contents of each file thus changed,
+// keyed by file name. Identical edits, such as those of a file that
+// appears in more than one package, are applied once; overlapping
+// edits are an error. Positions in errors are relative to dir.
+func (r *Runner) applyFixes(dir string, results []*Result) (map[string][]byte, error) {
+	edits := make(map[string][]offsetEdit)
+	for _, result := range results {
+		fset := result.Package.Fset
+		for _, d := range r.cfg.filter(result.Diagnostics) {
+			if len(d.SuggestedFixes) == 0 {
+				continue
+			}
+			posn := fset.Position(d.Pos)
+			posn.Filename = sanitize(dir, posn.Filename)
+			fix := d.SuggestedFixes[0].Message
+			for _, edit := range d.SuggestedFixes[0].TextEdits {
+				end := edit.End
+				if !end.IsValid() {
+					end = edit.Pos
+				}
+				file := fset.File(edit.Pos)
+				if file == nil || fset.File(end) != file || edit.Pos > end {
+					return nil, fmt.Errorf("%v: suggested fix %q has an invalid edit", posn, fix)
+				}
+				if !inDir(dir, file.Name()) {
+					continue // e.g. a generated test main package
+				}
+				edits[file.Name()] = append(edits[file.Name()], offsetEdit{file.Offset(edit.Pos), file.Offset(end), string(edit.NewText), posn.String(), fix})
+			}
+		}
+	}
+
+	fixed := make(map[string][]byte)
+	for filename, edits := range edits {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		content, err = applyEdits(content, edits)
+		if err != nil {
+			return nil, err
+		}
+		fixed[filename] = content
+	}
+	return fixed, nil
+}
+
+// applyEdits returns the result of applying the edits to content.
+// Duplicate edits are applied once, and overlapping edits are an error
+// that names the diagnostics of both.
+func applyEdits(content []byte, edits []offsetEdit) ([]byte, error) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		if edits[i].end != edits[j].end {
+			return edits[i].end < edits[j].end
+		}
+		return edits[i].newText < edits[j].newText
+	})
+	var out []byte
+	last := 0
+	var prev *offsetEdit // the last edit applied
+	for i := range edits {
+		edit := &edits[i]
+		if prev != nil && edit.start == prev.start && edit.end == prev.end && edit.newText == prev.newText {
+			continue // duplicate
+		}
+		if edit.end > len(content) {
+			return nil, fmt.Errorf("%s: suggested fix %q has an edit beyond the end of the file", edit.posn, edit.fix)
+		}
+		if edit.start < last {
+			if edit.posn == prev.posn {
+				return nil, fmt.Errorf("%s: suggested fix %q has overlapping edits", edit.posn, edit.fix)
+			}
+			return nil, fmt.Errorf("%s: suggested fix %q conflicts with suggested fix %q of the diagnostic at %s", edit.posn, edit.fix, prev.fix, prev.posn)
+		}
+		out = append(out, content[last:edit.start]...)
+		out = append(out, edit.newText...)
+		last = edit.end
+		prev = edit
+	}
+	return append(out, content[last:]...), nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestFixesIdempotent(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+	print()
+}
+`,
+		"a/a_test.go": `package a
+
+func g() {
+	print()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// removeprint's fixes remove the calls it reports.
+	analysistest.CheckFixesIdempotent(t, dir, removeprint, "a")
+
+	// commentprint's fixes merely add a comment.
+	commentprint := &analysis.Analyzer{
+		Name: "commentprint",
+		Doc:  "report calls of print",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "print") {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Pos(),
+							Message: "call of print",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message:   "Comment call",
+								TextEdits: []analysis.TextEdit{{Pos: call.Pos(), End: call.Pos(), NewText: []byte("/* fixed */ ")}},
+							}},
+						})
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckFixesIdempotent(t2, dir, commentprint, "a")
+	want := []string{
+		`a/a.go:4:14: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a.go:5:14: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a_test.go:4:14: diagnostic "call of print" is still reported after applying suggested fixes`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// argprint's fixes add an argument, after which the call
+	// is still reported, but without a fix.
+	argprint := &analysis.Analyzer{
+		Name: "argprint",
+		Doc:  "report calls of print",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "print") {
+						d := analysis.Diagnostic{Pos: call.Pos(), Message: "call of print"}
+						if len(call.Args) == 0 {
+							d.SuggestedFixes = []analysis.SuggestedFix{{
+								Message:   "Add argument",
+								TextEdits: []analysis.TextEdit{{Pos: call.Rparen, End: call.Rparen, NewText: []byte("0")}},
+							}}
+						}
+						pass.Report(d)
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	got = nil
+	analysistest.CheckFixesIdempotent(t2, dir, argprint, "a")
+	want = []string{
+		`a/a.go:4:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a.go:5:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a_test.go:4:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// breakprint's fixes merely move the call to the next line.
+	breakprint := &analysis.Analyzer{
+		Name: "breakprint",
+		Doc:  "report calls of print",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "print") {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Pos(),
+							Message: "call of print",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message:   "Break line",
+								TextEdits: []analysis.TextEdit{{Pos: call.Pos(), End: call.Pos(), NewText: []byte("\n\t")}},
+							}},
+						})
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	got = nil
+	analysistest.CheckFixesIdempotent(t2, dir, breakprint, "a")
+	want = []string{
+		`a/a.go:5:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a.go:7:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+		`a/a_test.go:5:2: diagnostic "call of print" is still reported after applying suggested fixes`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// isIdent reports whether e is the identifier name.
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+func TestPackageFixes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+	g()
+}
+`,
+		"a/a.go.golden": `package a
+
+func f() {
+	// want "call of print"
+	g()
+}
+`,
+		"a/b.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+		"a/b.go.golden": `package a
+
+func g() {
+	// want "call of print"
+}
+`,
+		"a/a_test.go": `package a
+
+func h() {
+	print() // want "call of print"
+}
+`,
+		"a/a_test.go.golden": `package a
+
+func h() {
+	print() // want "call of print"
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	print() // want "call of print" "empty call"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The fixes of a.go and b.go match their golden files, but
+	// not that of a_test.go.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunWithPackageFixes(t2, dir, removeprint, "a")
+	if len(got) != 1 || !strings.HasPrefix(got[0], "suggested fixes failed for a/a_test.go:") {
+		t.Errorf("got errors %q, want one for a/a_test.go", got)
+	}
+
+	// Fixes of different diagnostics that overlap are reported as
+	// a conflict.
+	removefill := &analysis.Analyzer{
+		Name: "removefill",
+		Doc:  "report calls of print, and empty ones",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			if _, err := removeprint.Run(pass); err != nil {
+				return nil, err
+			}
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "print") && len(call.Args) == 0 {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Rparen,
+							Message: "empty call",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message:   "Add argument",
+								TextEdits: []analysis.TextEdit{{Pos: call.Rparen, End: call.Rparen, NewText: []byte("1")}},
+							}},
+						})
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	got = nil
+	analysistest.RunWithPackageFixes(t2, dir, removefill, "b")
+	want := []string{
+		`b/b.go:4:8: suggested fix "Add argument" conflicts with suggested fix "Remove call" of the diagnostic at b/b.go:4:2`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
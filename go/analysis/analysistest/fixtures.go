@@ -0,0 +1,172 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+)
+
+// MainPackage returns a file map, suitable for WriteFiles, containing
+// the single file main.go of a main package in the directory path,
+// whose declarations are given by body. If body does not declare a
+// main function, an empty one is added so that the package is a
+// runnable program, as is required by analyzers that examine the
+// entry points of programs.
+func MainPackage(path, body string) map[string]string {
+	src := "package main\n\n" + body
+	if !declaresMain(src) {
+		src += "\nfunc main() {}\n"
+	}
+	return map[string]string{path + "/main.go": src}
+}
+
+// SingleFile returns a file map, suitable for WriteFiles, containing
+// a single file of a package in the directory dir, named after the
+// last element of dir (dir/x.go for a package x), whose declarations
+// are given by body. The file is formatted by gofmt, if possible, so
+// that the positions of its contents are predictable.
+func SingleFile(dir, body string) map[string]string {
+	name := path.Base(dir)
+	src := gofmt(fmt.Sprintf("package %s\n\n%s", name, body))
+	return map[string]string{dir + "/" + name + ".go": src}
+}
+
+// WithImports returns a copy of the file map, with an import
+// declaration of the specified packages added to each Go file,
+// after its package clause. Each file is formatted by gofmt, if
+// possible. For example:
+//
+//	analysistest.WithImports(analysistest.SingleFile("a", body), "fmt", "os")
+func WithImports(filemap map[string]string, imports ...string) map[string]string {
+	result := make(map[string]string)
+	for name, src := range filemap {
+		if strings.HasSuffix(name, ".go") && len(imports) > 0 {
+			src = addImports(src, imports)
+		}
+		result[name] = src
+	}
+	return result
+}
+
+// addImports adds an import declaration of the specified packages to
+// the source of a file, after its package clause, and formats it. It
+// returns src unchanged if it cannot be parsed.
+func addImports(src string, imports []string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return src
+	}
+	end := int(f.Name.End()) - 1 // the file's base is 1
+	var decl strings.Builder
+	decl.WriteString("\n\nimport (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&decl, "\t%q\n", path)
+	}
+	decl.WriteString(")")
+	return gofmt(src[:end] + decl.String() + src[end:])
+}
+
+// gofmt returns the formatted source of a file,
+// or src unchanged if it cannot be parsed.
+func gofmt(src string) string {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return src
+	}
+	return string(formatted)
+}
+
+// declaresMain reports whether the source of a file declares
+// a func main. It returns false if the file cannot be parsed.
+func declaresMain(src string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", src, 0)
+	if err != nil {
+		return false
+	}
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil && decl.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoredFile returns a file map, suitable for WriteFiles, containing
+// the single file ignored.go of a package in the directory dir, which
+// is excluded from the build by an "ignore" build constraint, and whose
+// declarations are given by body. Adding it to a test's files checks
+// that the analyzer tolerates a file that is not part of the package,
+// as a driver would present it: Run reports an error if the analyzer
+// fails, or reports a diagnostic in the file.
+func IgnoredFile(dir, body string) map[string]string {
+	src := fmt.Sprintf("//go:build ignore\n// +build ignore\n\npackage %s\n\n%s", path.Base(dir), body)
+	return map[string]string{dir + "/ignored.go": gofmt(src)}
+}
+
+// RecursiveTypes returns a file map, suitable for WriteFiles, containing
+// the single file recursive.go of a package in the directory dir that
+// declares many kinds of recursive type, such as
+//
+//	type List struct { next *List }
+//
+// An analyzer that walks types without keeping track of those it has
+// already visited does not terminate on such types; use WithTimeout
+// to detect this. The file has no 'want' comments.
+func RecursiveTypes(dir string) map[string]string {
+	return map[string]string{dir + "/recursive.go": "package " + path.Base(dir) + `
+
+type List struct {
+	next *List
+	val  int
+}
+
+type Tree struct {
+	children []Tree
+}
+
+type Map map[string]Map
+
+type Chan chan Chan
+
+type Func func(Func) Func
+
+type Pointer *Pointer
+
+type Node interface {
+	Next() Node
+}
+
+// A and B are mutually recursive.
+type A struct{ b *B }
+type B struct{ a []A }
+
+type Array [2]*Array
+
+type Anonymous struct {
+	inner struct {
+		outer *Anonymous
+	}
+}
+
+var (
+	_ List
+	_ Tree
+	_ Map
+	_ Chan
+	_ Func
+	_ Pointer
+	_ Node
+	_ A
+	_ Array
+	_ Anonymous
+)
+`}
+}
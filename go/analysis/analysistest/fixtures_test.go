@@ -0,0 +1,214 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/parser"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestMainPackage(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	filemap := analysistest.MainPackage("cmd/hello", `func hello() {
+	println("hello") // want "call of println"
+}
+`)
+	want := `package main
+
+func hello() {
+	println("hello") // want "call of println"
+}
+
+func main() {}
+`
+	if got := filemap["cmd/hello/main.go"]; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	results := analysistest.Run(t, dir, printcall, "cmd/hello")
+	for _, result := range results {
+		if name := result.Pass.Pkg.Name(); name != "main" {
+			t.Errorf("%s: package name is %s, want main", result.Pass, name)
+		}
+	}
+}
+
+// typewalk walks the type of each package-level type, visiting
+// each type once. It reports nothing.
+var typewalk = &analysis.Analyzer{
+	Name: "typewalk",
+	Doc:  "walk types",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		seen := make(map[types.Type]bool)
+		var walk func(T types.Type)
+		walk = func(T types.Type) {
+			if seen[T] {
+				return
+			}
+			seen[T] = true
+			switch T := T.(type) {
+			case *types.Named:
+				walk(T.Underlying())
+				for i := 0; i < T.NumMethods(); i++ {
+					walk(T.Method(i).Type())
+				}
+			case *types.Pointer:
+				walk(T.Elem())
+			case *types.Slice:
+				walk(T.Elem())
+			case *types.Array:
+				walk(T.Elem())
+			case *types.Chan:
+				walk(T.Elem())
+			case *types.Map:
+				walk(T.Key())
+				walk(T.Elem())
+			case *types.Struct:
+				for i := 0; i < T.NumFields(); i++ {
+					walk(T.Field(i).Type())
+				}
+			case *types.Interface:
+				for i := 0; i < T.NumMethods(); i++ {
+					walk(T.Method(i).Type())
+				}
+			case *types.Signature:
+				walk(T.Params())
+				walk(T.Results())
+			case *types.Tuple:
+				for i := 0; i < T.Len(); i++ {
+					walk(T.At(i).Type())
+				}
+			}
+		}
+		for _, name := range pass.Pkg.Scope().Names() {
+			walk(pass.Pkg.Scope().Lookup(name).Type())
+		}
+		return nil, nil
+	},
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(analysistest.RecursiveTypes("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithTimeout(time.Minute)).Run(t, dir, typewalk, "a")
+
+	// An analysis that does not finish is reported.
+	block := make(chan struct{})
+	defer close(block)
+	hang := &analysis.Analyzer{
+		Name: "hang",
+		Doc:  "never finish",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			<-block
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithTimeout(100*time.Millisecond)).Run(t2, dir, hang, "a")
+	want := []string{"analysis did not finish within 100ms; still running: hang@a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	filemap := analysistest.WithImports(analysistest.SingleFile("x/a", `
+func f() {
+println(fmt.Sprint(os.Args)) // want "call of println"
+}`), "fmt", "os")
+	want := `package a
+
+import (
+	"fmt"
+	"os"
+)
+
+func f() {
+	println(fmt.Sprint(os.Args)) // want "call of println"
+}
+`
+	if got := filemap["x/a/a.go"]; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, printcall, "x/a")
+}
+
+func TestIgnoredFile(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	filemap := analysistest.IgnoredFile("x/a", `func g() { print() }`)
+	filemap["x/a/a.go"] = `package a
+
+func f() {
+	print() // want "call of print"
+}
+`
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// printcall does not see the ignored file.
+	analysistest.Run(t, dir, printcall, "x/a")
+
+	// ignoredcall reports in it.
+	ignoredcall := &analysis.Analyzer{
+		Name: "ignoredcall",
+		Doc:  "report the package clauses of ignored files",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, name := range pass.IgnoredFiles {
+				f, err := parser.ParseFile(pass.Fset, name, nil, 0)
+				if err != nil {
+					return nil, err
+				}
+				pass.Reportf(f.Package, "ignored file")
+			}
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, ignoredcall, "x/a")
+	want := []string{
+		`x/a/ignored.go:4:1: unexpected diagnostic: ignored file`,
+		`x/a/ignored.go:4:1: diagnostic "ignored file" is reported in a file that is excluded from the build`,
+		`x/a/a.go:4: no diagnostic was reported matching "call of print"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
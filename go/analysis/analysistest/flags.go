@@ -0,0 +1,86 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// AssertFlagDefaults returns an error if the default value of a flag of
+// the analyzer, in its string form, differs from that given by want,
+// which maps flag names to default values, or if the analyzer has no
+// flag of one of the names. Flags not mentioned by want are ignored.
+//
+// It allows a test of a parameterized analyzer to check that the
+// defaults of its flags are those documented, since a change of a
+// default changes the behavior of every driver that does not set the
+// flag. It compares the DefValue of each flag, which is unaffected by
+// setting the flag, so it may be called after a test has done so.
+func AssertFlagDefaults(a *analysis.Analyzer, want map[string]string) error {
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		f := a.Flags.Lookup(name)
+		if f == nil {
+			errs = append(errs, fmt.Sprintf("no flag -%s", name))
+		} else if f.DefValue != want[name] {
+			errs = append(errs, fmt.Sprintf("flag -%s has default %q, want %q", name, f.DefValue, want[name]))
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("analyzer %s: %s", a.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// enableChecks sets each boolean flag of the analyzer to whether it is
+// one of the checks (see WithEnabledChecks), and returns the set of the
+// names of the disabled checks and a function that restores the flags.
+// It returns an error if one of the checks is not a boolean flag.
+func enableChecks(a *analysis.Analyzer, checks []string) (disabled map[string]bool, restore func(), err error) {
+	enabled := make(map[string]bool)
+	for _, name := range checks {
+		if f := a.Flags.Lookup(name); f == nil || !isBoolFlag(f) {
+			return nil, nil, fmt.Errorf("analyzer %s has no boolean flag -%s to enable check %s", a.Name, name, name)
+		}
+		enabled[name] = true
+	}
+
+	disabled = make(map[string]bool)
+	saved := make(map[*flag.Flag]string)
+	a.Flags.VisitAll(func(f *flag.Flag) {
+		if !isBoolFlag(f) {
+			return
+		}
+		saved[f] = f.Value.String()
+		f.Value.Set(strconv.FormatBool(enabled[f.Name])) // can't fail
+		if !enabled[f.Name] {
+			disabled[f.Name] = true
+		}
+	})
+	return disabled, func() {
+		for f, value := range saved {
+			f.Value.Set(value)
+		}
+	}, nil
+}
+
+// isBoolFlag reports whether the flag is boolean, in the sense of
+// package flag: one that may be set by its name alone.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
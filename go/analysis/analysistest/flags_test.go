@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/findcall"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestAssertFlagDefaults(t *testing.T) {
+	if err := analysistest.AssertFlagDefaults(findcall.Analyzer, map[string]string{"name": ""}); err != nil {
+		t.Error(err)
+	}
+
+	err := analysistest.AssertFlagDefaults(findcall.Analyzer, map[string]string{
+		"name":    "println",
+		"verbose": "false",
+	})
+	want := `analyzer findcall: flag -name has default "", want "println"; no flag -verbose`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// printchecks returns an analyzer with two checks, print and println,
+// each enabled by a flag, that report calls of the builtins of their
+// names in the category of the check. If buggy, it ignores the flag
+// of the println check.
+func printchecks(buggy bool) *analysis.Analyzer {
+	a := &analysis.Analyzer{
+		Name: "printchecks",
+		Doc:  "report calls of print and println",
+	}
+	enabled := map[string]*bool{
+		"print":   a.Flags.Bool("print", true, "report calls of print"),
+		"println": a.Flags.Bool("println", true, "report calls of println"),
+	}
+	a.Run = func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					for name, on := range enabled {
+						if isIdent(call.Fun, name) && (*on || buggy && name == "println") {
+							pass.Report(analysis.Diagnostic{
+								Pos:      call.Pos(),
+								Category: name,
+								Message:  "call of " + name,
+							})
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	}
+	return a
+}
+
+func TestEnabledChecks(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	a := printchecks(false)
+	analysistest.NewRunner(analysistest.WithEnabledChecks("print")).Run(t, dir, a, "a")
+	if got := a.Flags.Lookup("println").Value.String(); got != "true" {
+		t.Errorf("after Run, flag -println is %s, want true", got)
+	}
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithEnabledChecks("print")).Run(t2, dir, printchecks(true), "a")
+	want := []string{
+		`a/a.go:5:2: unexpected diagnostic: call of println`,
+		`a/a.go:5:2: diagnostic "call of println" is reported by check println, which is disabled`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got = nil
+	analysistest.NewRunner(analysistest.WithEnabledChecks("printf")).Run(t2, dir, a, "a")
+	want = []string{`analyzer printchecks has no boolean flag -printf to enable check printf`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"golang.org/x/tools/go/analysis"
+)
+
+// A Generator produces files for a test of an analyzer that is meant
+// to run on the output of a code generator; see RunGenerated. Given
+// the root of the source files of the test data, which is dir/src for
+// a GOPATH-style tree, or dir for a module, it returns a map from the
+// name of each file it generates, slash-separated and relative to the
+// root, to its contents.
+type Generator func(root string) (map[string]string, error)
+
+// RunGenerated tests an analyzer together with a code generator. It
+// runs the generator on the test data in dir, then applies the analysis
+// to the packages denoted by patterns, including the generated files,
+// as Run does. The generated files are added as an overlay (see
+// WithOverlay), so the test data are not modified, and their 'want'
+// comments, which the generator must emit, are checked along with
+// those of the other files. An error of the generator is reported to t.
+func RunGenerated(t Testing, dir string, a *analysis.Analyzer, generate Generator, patterns ...string) []*Result {
+	return NewRunner().RunGenerated(t, dir, a, generate, patterns...)
+}
+
+// RunGenerated behaves like the package-level RunGenerated function,
+// but uses the Runner's configuration.
+func (r *Runner) RunGenerated(t Testing, dir string, a *analysis.Analyzer, generate Generator, patterns ...string) []*Result {
+	files, err := generate(sourceRoot(dir))
+	if err != nil {
+		t.Errorf("generating files in %s: %v", dir, err)
+		return nil
+	}
+	r2 := &Runner{cfg: r.cfg}
+	WithOverlay(files).set(&r2.cfg)
+	return r2.Run(t, dir, a, patterns...)
+}
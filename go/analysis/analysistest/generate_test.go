@@ -0,0 +1,70 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestRunGenerated(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go":      "package a\n",
+		"a/calls.txt": "print\nprintln\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// generate writes a function that calls each function listed in
+	// calls.txt, expecting a diagnostic for each call, unless wrong.
+	generate := func(wrong string) analysistest.Generator {
+		return func(root string) (map[string]string, error) {
+			data, err := ioutil.ReadFile(filepath.Join(root, "a", "calls.txt"))
+			if err != nil {
+				return nil, err
+			}
+			var buf strings.Builder
+			buf.WriteString("package a\n\nfunc generated() {\n")
+			for _, name := range strings.Fields(string(data)) {
+				want := name
+				if name == wrong {
+					want = "wrong"
+				}
+				fmt.Fprintf(&buf, "\t%s() // want \"call of %s$\"\n", name, want)
+			}
+			buf.WriteString("}\n")
+			return map[string]string{"a/gen.go": buf.String()}, nil
+		}
+	}
+
+	analysistest.RunGenerated(t, dir, printcall, generate(""), "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunGenerated(t2, dir, printcall, generate("println"), "a")
+	want := []string{
+		`a/gen.go:5:2: diagnostic "call of println" does not match pattern "call of wrong$"`,
+		`a/gen.go:5: no diagnostic was reported matching "call of wrong$"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The test data are not modified.
+	if _, err := ioutil.ReadFile(filepath.Join(dir, "src", "a", "gen.go")); err == nil {
+		t.Errorf("RunGenerated wrote gen.go to the test data")
+	}
+}
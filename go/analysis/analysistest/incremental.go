@@ -0,0 +1,69 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// A Stage is a step of an incremental test (see RunIncremental):
+// a set of edits to the files of the packages under test.
+//
+// Edits maps the name of each edited file, relative to the source root
+// as for WithOverlay, to its new contents. The 'want' comments in the
+// new contents are the expectations of the stage for that file.
+type Stage struct {
+	Edits map[string]string
+}
+
+// RunIncremental simulates the loop of an editor, in which the packages
+// under test are analyzed, then edited, then analyzed again, and so on.
+// It applies an analysis to the packages denoted by patterns in dir as
+// Run does, then, for each stage in turn, applies its edits as an
+// overlay (see WithOverlay) to the files as left by the preceding
+// stages, and applies the analysis again, checking the expectations of
+// the files as edited. Errors are prefixed by the number of the stage
+// at which they were reported, where the initial run is stage 0.
+//
+// RunIncremental returns the results of each stage.
+func RunIncremental(t Testing, dir string, a *analysis.Analyzer, stages []Stage, patterns ...string) [][]*Result {
+	return NewRunner().RunIncremental(t, dir, a, stages, patterns...)
+}
+
+// RunIncremental behaves like the package-level RunIncremental
+// function, but uses the Runner's configuration.
+func (r *Runner) RunIncremental(t Testing, dir string, a *analysis.Analyzer, stages []Stage, patterns ...string) [][]*Result {
+	if t, ok := t.(testenv.Testing); ok {
+		testenv.NeedsGoPackages(t)
+	}
+
+	results := [][]*Result{
+		r.Run(stageTesting{t, 0}, dir, a, patterns...),
+	}
+	r2 := &Runner{cfg: r.cfg}
+	for i, stage := range stages {
+		WithOverlay(stage.Edits).set(&r2.cfg)
+		results = append(results, r2.Run(stageTesting{t, i + 1}, dir, a, patterns...))
+	}
+	return results
+}
+
+// A stageTesting prefixes the errors reported to a Testing
+// during a stage of RunIncremental with its number.
+type stageTesting struct {
+	Testing
+	stage int
+}
+
+func (t stageTesting) Errorf(format string, args ...interface{}) {
+	t.Testing.Errorf("stage %d: %s", t.stage, fmt.Sprintf(format, args...))
+}
+
+func (t stageTesting) Logf(format string, args ...interface{}) {
+	logf(t.Testing, format, args...)
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestRunIncremental(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"a/b.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	stages := []analysistest.Stage{
+		{Edits: map[string]string{
+			"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+}
+`,
+		}},
+		{Edits: map[string]string{
+			"a/b.go": `package a
+
+func g() {}
+`,
+		}},
+	}
+	results := analysistest.RunIncremental(t, dir, printcall, stages, "a")
+	if len(results) != 3 {
+		t.Errorf("got results of %d stages, want 3", len(results))
+	}
+
+	// Errors are prefixed by their stage.
+	stages[1].Edits["a/b.go"] = `package a
+
+func g() {
+	print()
+}
+`
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.RunIncremental(t2, dir, printcall, stages, "a")
+	want := []string{
+		"stage 2: a/b.go:4:2: unexpected diagnostic: call of print",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
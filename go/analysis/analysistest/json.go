@@ -0,0 +1,101 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"encoding/json"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/internal/analysisflags"
+)
+
+// jsonDiagnostic is the form of a diagnostic in the -json output of
+// drivers, such as unitchecker; see analysisflags.JSONTree.
+type jsonDiagnostic struct {
+	Category string `json:"category,omitempty"`
+	Posn     string `json:"posn"`
+	Message  string `json:"message"`
+	URL      string `json:"url,omitempty"`
+}
+
+// roundTripJSON encodes the diagnostics of pass in the -json output
+// format of drivers, decodes them, and returns the decoded diagnostics.
+// It reports an error for each diagnostic whose position cannot be
+// decoded; such diagnostics are omitted from the result.
+func roundTripJSON(t Testing, gopath string, pass *analysis.Pass, id string, diagnostics []analysis.Diagnostic) []analysis.Diagnostic {
+	tree := make(analysisflags.JSONTree)
+	tree.Add(pass.Fset, id, pass.Analyzer.Name, diagnostics, nil)
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Errorf("encoding diagnostics of %s as JSON: %v", id, err)
+		return nil
+	}
+	var decoded map[string]map[string][]jsonDiagnostic
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Errorf("decoding JSON diagnostics of %s: %v", id, err)
+		return nil
+	}
+
+	files := fileIndex(pass.Fset)
+
+	var result []analysis.Diagnostic
+	for _, d := range decoded[id][pass.Analyzer.Name] {
+		pos := decodePosn(files, d.Posn)
+		if !pos.IsValid() {
+			t.Errorf("diagnostic %q has invalid position %q after JSON round trip", d.Message, sanitize(gopath, d.Posn))
+			continue
+		}
+		result = append(result, analysis.Diagnostic{
+			Pos:      pos,
+			Category: d.Category,
+			Message:  d.Message,
+			URL:      d.URL,
+		})
+	}
+	return result
+}
+
+// fileIndex returns the files of fset by name, to decode positions.
+func fileIndex(fset *token.FileSet) map[string]*token.File {
+	files := make(map[string]*token.File)
+	fset.Iterate(func(f *token.File) bool {
+		files[f.Name()] = f
+		return true
+	})
+	return files
+}
+
+// decodePosn returns the position denoted by posn, of the form
+// "file:line:col" or "file:line", or NoPos if it denotes none.
+func decodePosn(files map[string]*token.File, posn string) token.Pos {
+	// The file name may itself contain colons, so parse from the right.
+	col := 1
+	i := strings.LastIndex(posn, ":")
+	if i < 0 {
+		return token.NoPos
+	}
+	n, err := strconv.Atoi(posn[i+1:])
+	if err != nil {
+		return token.NoPos
+	}
+	line := n
+	if j := strings.LastIndex(posn[:i], ":"); j >= 0 {
+		if n2, err := strconv.Atoi(posn[j+1 : i]); err == nil {
+			line, col, i = n2, n, j
+		}
+	}
+	f := files[posn[:i]]
+	if f == nil || line < 1 || line > f.LineCount() {
+		return token.NoPos
+	}
+	pos := f.LineStart(line) + token.Pos(col-1)
+	if int(pos) > f.Base()+f.Size() {
+		return token.NoPos
+	}
+	return pos
+}
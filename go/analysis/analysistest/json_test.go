@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// printarg reports the string argument of each call of println, and
+// each call without arguments, at no position.
+var printarg = &analysis.Analyzer{
+	Name: "printarg",
+	Doc:  "report arguments of println",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "println" {
+						if len(call.Args) == 0 {
+							pass.Reportf(token.NoPos, "println without arguments")
+						} else if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							s, _ := strconv.Unquote(lit.Value)
+							pass.Reportf(call.Pos(), "println of %s", s)
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println("café <&> \"q\"\t\u2028") // want "println of café <&> \"q\"\t\u2028"
+	println("line 1\nline 2")          // want "println of line 1\nline 2"
+}
+`,
+		"b/b.go": `package b
+
+func g() {
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	r := analysistest.NewRunner(analysistest.WithJSONRoundTrip())
+	r.Run(t, dir, printarg, "a")
+
+	// A diagnostic without a position does not survive.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	r.Run(t2, dir, printarg, "b")
+	want := []string{
+		`diagnostic "println without arguments" has invalid position "-" after JSON round trip`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
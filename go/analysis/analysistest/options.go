@@ -0,0 +1,954 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"go/token"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// An Option configures the behavior of a Runner.
+type Option interface {
+	set(*config)
+}
+
+type optionSetter func(*config)
+
+func (f optionSetter) set(cfg *config) {
+	f(cfg)
+}
+
+// config holds the settings of a Runner.
+// The zero value gives the behavior of the package-level Run function.
+type config struct {
+	narrowLines int  // if positive, see WithNarrowestNode
+	syntaxOnly  bool // load syntax but not types
+	timing      bool // log a timing report
+	trimSpace   bool // ignore leading and trailing space in messages
+	anchored    bool // patterns must match whole messages
+	noFixes     bool // reject diagnostics with suggested fixes
+	noDups      bool // reject duplicate diagnostics
+	category    bool // reject diagnostics without a category
+	noDupFacts  bool // reject facts exported twice
+	noInText    bool // reject diagnostics within comments and literals
+	regions     bool // reject diagnostics outside BEGIN/END regions
+
+	suppress     string // if non-empty, see WithSuppression
+	suppressNext bool   // the suppression directive applies to the next line
+
+	roundTripJSON  bool // see WithJSONRoundTrip
+	updateSidecars bool // see WithSidecarUpdate
+	updateWants    bool // see WithWantUpdate
+
+	wantPrefixes map[string]string // see WithWantPrefixes
+
+	compileFixes bool // type-check the results of suggested fixes
+
+	report, updateReport       bool      // see WithGoldenReport
+	jsonGolden, updateJSON     bool      // see WithJSONGolden
+	resultGolden, updateResult bool      // see WithResultGolden
+	snapshot                   io.Writer // if non-nil, see WithSnapshot
+	coverage                   *Coverage // if non-nil, see WithCoverage
+
+	formatResult func(interface{}) []byte // if non-nil, see WithResultGolden
+
+	snapshotFile   string // if non-empty, see WithSnapshotFile
+	updateSnapshot bool   // see WithSnapshotFile
+
+	fset *token.FileSet // if non-nil, see WithFileSet
+
+	buildTags    []string      // build tags to enable when loading
+	goos, goarch string        // if non-empty, the target platform
+	goflags      string        // if non-empty, see WithGoFlags
+	wantPackages int           // if positive, see WantPackages
+	timeout      time.Duration // if positive, see WithTimeout
+	stress       int           // if positive, see WithStress
+	nodeBudget   int           // if positive, see WithNodeBudget
+	maxParallel  int           // if positive, see MaxParallel
+	maxFindings  int           // if positive, see WithMaxFindings
+	checker      Checker       // if non-nil, see WithChecker
+
+	codePattern *regexp.Regexp // if non-nil, see WithCodePattern
+	idPattern   *regexp.Regexp // if non-nil, see WithIDPattern
+
+	cpuProfile, memProfile string // if non-empty, see WithProfiling
+
+	record, replay string // if non-empty, see RecordPackages and ReplayPackages
+
+	tapReport, junitReport io.Writer // if non-nil, see WithTAPReport and WithJUnitReport
+
+	maxAlloc uint64 // if positive, see WithMaxAlloc
+
+	// overlay maps the names of files, relative to the
+	// source root, to the contents that replace them.
+	overlay map[string]string
+
+	// despiteErrors, if non-nil, overrides the RunDespiteErrors
+	// field of each analyzer.
+	despiteErrors *bool
+
+	// nonGoFiles maps the extension of each kind of
+	// non-Go file to its line comment prefix.
+	nonGoFiles map[string]string
+
+	keep         func(*analysis.Diagnostic) bool // if non-nil, see WithFindingFilter
+	exportedOnly bool                            // see WithExportedOnly
+
+	enabledChecks []string // if non-nil, see WithEnabledChecks
+
+	// facts maps the path of each package to the facts
+	// supplied for it by WithImportedFact.
+	facts map[string][]importedFact
+}
+
+// An importedFact is a fact supplied by WithImportedFact.
+type importedFact struct {
+	name string // of the object, or "" for a package fact
+	fact analysis.Fact
+}
+
+// compile compiles the pattern of an expectation.
+func (cfg *config) compile(pattern string) (*regexp.Regexp, error) {
+	if cfg.trimSpace {
+		pattern = strings.TrimSpace(pattern)
+	}
+	if cfg.anchored {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	return regexp.Compile(pattern)
+}
+
+// message returns the form of a diagnostic's message
+// that is matched against expectations.
+func (cfg *config) message(msg string) string {
+	if cfg.trimSpace {
+		msg = strings.TrimSpace(msg)
+	}
+	return msg
+}
+
+// defaultCodePattern extracts the code of a message
+// of the form "[code] text", such as "[SA1000] ...".
+var defaultCodePattern = regexp.MustCompile(`^\[([^\]]*)\]`)
+
+// codeOf returns the pattern that extracts the code of a message
+// for a 'code:"code"' expectation.
+func (cfg *config) codeOf() *regexp.Regexp {
+	if cfg.codePattern != nil {
+		return cfg.codePattern
+	}
+	return defaultCodePattern
+}
+
+// filter returns the diagnostics to which expectations apply.
+func (cfg *config) filter(diagnostics []analysis.Diagnostic) []analysis.Diagnostic {
+	if cfg.keep == nil {
+		return diagnostics
+	}
+	var kept []analysis.Diagnostic
+	for i := range diagnostics {
+		if cfg.keep(&diagnostics[i]) {
+			kept = append(kept, diagnostics[i])
+		}
+	}
+	return kept
+}
+
+// wantKeyword returns the word that introduces the expectations of
+// comments in the package of pass, by default "want".
+func (cfg *config) wantKeyword(pass *analysis.Pass) string {
+	if pass.Pkg != nil {
+		if prefix, ok := cfg.wantPrefixes[pass.Pkg.Path()]; ok {
+			return prefix
+		}
+	}
+	return "want"
+}
+
+// commentPrefix returns the prefix of a line
+// comment in the specified non-Go file.
+func (cfg *config) commentPrefix(filename string) string {
+	if prefix, ok := cfg.nonGoFiles[filepath.Ext(filename)]; ok {
+		return prefix
+	}
+	return "//"
+}
+
+// WithNarrowestNode enables a check that each diagnostic is reported
+// at a specific syntax node, such as an identifier or expression,
+// rather than at a large construct such as a whole statement or
+// declaration. A diagnostic fails the check if the innermost syntax
+// node enclosing its Pos-End range spans more than maxLines lines.
+//
+// Diagnostics with no End are reported at a point, and so always pass.
+// The check is a heuristic intended to help analyzer authors report
+// findings where editors can highlight them usefully; maxLines sets
+// its strictness.
+func WithNarrowestNode(maxLines int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.narrowLines = maxLines
+	})
+}
+
+// WithSyntaxOnly causes the Runner to load the packages under test
+// with syntax trees but without type information, which is much
+// faster, and is sufficient for purely syntactic analyzers.
+//
+// The Pass of each such analysis has nil Pkg, TypesInfo, and
+// TypesSizes fields, which the analyzer must tolerate. Analyzers that
+// use facts (or that require analyzers that do) need type information,
+// and the Runner logs a warning if asked to run one in this mode.
+// If the analyzer panics, for example because it uses the nil TypesInfo,
+// the Runner reports the panic as an error rather than crashing.
+func WithSyntaxOnly() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.syntaxOnly = true
+	})
+}
+
+// WithTimingReport causes the Runner to log, at the end of each Run,
+// the time spent loading packages and analyzing them, followed by the
+// analysis time of each package in descending order, which helps to
+// identify a pathologically slow package in a large suite.
+//
+// The report is logged only if the Testing supports a Logf method,
+// as *testing.T does, so it appears only in verbose test output.
+func WithTimingReport() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.timing = true
+	})
+}
+
+// WithTrimmedMessages causes the Runner to remove leading and trailing
+// white space from each diagnostic message, and from the text of each
+// diagnostic pattern, before matching them, so that expectations are
+// not sensitive to incidental changes to the white space surrounding a
+// message. It is not the default because such white space is sometimes
+// meaningful.
+func WithTrimmedMessages() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.trimSpace = true
+	})
+}
+
+// WithNoFixes enables a check that no diagnostic carries a suggested
+// fix. It enforces, and documents, the design of an advisory analyzer
+// that is never supposed to fix the code it reports on.
+func WithNoFixes() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.noFixes = true
+	})
+}
+
+// WithNonGoFiles causes the Runner to extract 'want' comments from the
+// files in each package's directory whose names have the extension ext
+// (for example, ".yaml"), in which a line comment begins with the
+// prefix comment (for example, "#"):
+//
+//	key: value # want "unknown key"
+//
+// This allows testing of analyzers that report diagnostics in files
+// such as templates or configuration files that, unlike assembly
+// files, go/packages does not consider part of the package.
+// The option also determines the syntax of comments in files of the
+// package's OtherFiles that have the extension ext; otherwise these
+// use "//" comments. It may be repeated for each kind of file.
+func WithNonGoFiles(ext, comment string) Option {
+	return optionSetter(func(cfg *config) {
+		if cfg.nonGoFiles == nil {
+			cfg.nonGoFiles = make(map[string]string)
+		}
+		cfg.nonGoFiles[ext] = comment
+	})
+}
+
+// WithFindingFilter causes the Runner to consider only the diagnostics
+// for which keep returns true, for example those of a particular
+// Category, so that one facet of an analyzer that reports several kinds
+// of diagnostic can be tested in isolation. The diagnostics that are
+// filtered out are neither matched against expectations nor reported as
+// unexpected, and their suggested fixes are not applied.
+//
+// Because a filter can mask real problems, it should be as specific
+// as possible.
+func WithFindingFilter(keep func(*analysis.Diagnostic) bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.keep = keep
+	})
+}
+
+// WithTypeErrors causes the Runner to apply the analyzer, and those it
+// requires, to packages that contain type errors, as gopls does for the
+// code being edited, regardless of the analyzers' RunDespiteErrors
+// fields. Such a package is only partially typed: the TypesInfo may
+// lack the types of some expressions, and others may be invalid, which
+// the analyzer must tolerate.
+//
+// Type errors are still printed, but do not cause the test to fail.
+func WithTypeErrors() Option {
+	return WithRunDespiteErrors(true)
+}
+
+// WithGoldenReport causes the Runner to compare a report of all the
+// diagnostics of each package, including their categories and suggested
+// fixes, against the golden file dir/path.report, where dir is the test
+// directory and path is the package path; for example, the report for
+// package a of testdata/src/a is testdata/a.report. Diagnostics are
+// listed in the form of NormalizeFindings, each followed by its
+// suggested fixes and their edits, so that the file is deterministic
+// and changes to it are easy to review.
+//
+// This is the most comprehensive form of golden test, and suits
+// analyzers whose output is large or interrelated. The 'want' comments
+// of the packages are checked as usual.
+//
+// If update is set, the Runner instead writes the golden files.
+// Typically, its value is that of a test flag:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	analysistest.NewRunner(analysistest.WithGoldenReport(*update)).Run(...)
+func WithGoldenReport(update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.report = true
+		cfg.updateReport = update
+	})
+}
+
+// WithRunDespiteErrors overrides the RunDespiteErrors field of the
+// analyzer, and of those it requires, so that both behaviors of an
+// analyzer can be tested. If run is true, the analyzers are applied to
+// packages with errors, as if by WithTypeErrors. If run is false, the
+// packages that have errors, or depend on packages that do, are
+// excluded from analysis, and their expectations are not checked;
+// the Runner logs the name of each excluded package.
+func WithRunDespiteErrors(run bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.despiteErrors = &run
+	})
+}
+
+// WithBuildTags causes the Runner to load the packages under test with
+// the specified build tags enabled, so that files whose build
+// constraints require them are analyzed and their expectations checked.
+func WithBuildTags(tags ...string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.buildTags = tags
+	})
+}
+
+// WantPackages causes the Runner to check that the patterns of each
+// Run denote exactly n packages, which guards against a pattern that
+// silently matches too few or too many packages, for example because
+// a package of the test data was moved or excluded by a build tag.
+//
+// The packages are counted after loading, so the test variant of a
+// package, its external test package, and its generated test main
+// package each count separately.
+func WantPackages(n int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.wantPackages = n
+	})
+}
+
+// WithOverlay causes the Runner to load the packages under test as if
+// the contents of each file named by a key of files were replaced by
+// the corresponding value, without modifying the test data; see the
+// Overlay field of packages.Config. A file need not exist on disk.
+// File names are slash-separated and relative to the source root, which
+// is dir/src for a GOPATH-style tree, or dir for a module. The 'want'
+// comments of an overlaid Go file are taken from its new contents.
+// The option may be repeated; later overlays of a file take precedence.
+func WithOverlay(files map[string]string) Option {
+	return optionSetter(func(cfg *config) {
+		overlay := make(map[string]string)
+		for name, content := range cfg.overlay {
+			overlay[name] = content
+		}
+		for name, content := range files {
+			overlay[name] = content
+		}
+		cfg.overlay = overlay
+	})
+}
+
+// WithImportedFact supplies a fact of the analyzer under test about a
+// dependency of the packages under test, so that the analyzer's
+// consumption of facts can be tested in isolation from their
+// production. The analyzer is not applied to the package whose path is
+// pkgpath; instead, the facts of that package are exactly those supplied
+// for it, as if the analyzer had exported them. If name is empty, the
+// fact is a package fact; otherwise it is a fact about the package-level
+// object of that name. The option may be repeated.
+//
+// The option has no effect on the packages under test themselves.
+func WithImportedFact(pkgpath, name string, fact analysis.Fact) Option {
+	return optionSetter(func(cfg *config) {
+		facts := make(map[string][]importedFact)
+		for path, f := range cfg.facts {
+			facts[path] = f
+		}
+		f := append([]importedFact(nil), facts[pkgpath]...)
+		facts[pkgpath] = append(f, importedFact{name, fact})
+		cfg.facts = facts
+	})
+}
+
+// WithSnapshot causes the Runner to write to w, after each Run, the
+// diagnostics of all the packages under test in the form of
+// NormalizeFindings, one per line, so that they can be compared against
+// a stored snapshot by an external snapshot or approval testing
+// framework. The format is stable: diagnostics are sorted by position,
+// and file names do not depend on the location of the test data.
+//
+// The snapshot is written whether or not the diagnostics match the
+// 'want' comments of the packages, which are checked as usual.
+func WithSnapshot(w io.Writer) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.snapshot = w
+	})
+}
+
+// WithTimeout causes the Runner to report an error if the analysis of
+// the packages under test does not finish within d, naming each package
+// whose analysis is still running, which is likely to be stuck in an
+// infinite loop, for example while walking a recursive type (see
+// RecursiveTypes). The analysis is abandoned, not stopped: its goroutines
+// continue to run until the test binary exits.
+func WithTimeout(d time.Duration) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.timeout = d
+	})
+}
+
+// WithCompilableFixes causes RunWithSuggestedFixes to check that the
+// code produced by applying suggested fixes still compiles. For each
+// fixed file, it reloads and type-checks the package of the file with
+// the file's contents replaced by the fixed contents (after applying
+// each fix separately, if the golden file has a section for each fix),
+// and reports any errors. This catches fixes that produce well-formed
+// but broken code, such as those that remove an import still in use.
+func WithCompilableFixes() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.compileFixes = true
+	})
+}
+
+// WithNoDuplicates causes the Runner to report an error for each
+// diagnostic that is reported more than once, with the same position and
+// message, during the analysis of a package. Such duplicates are usually
+// a bug in the analyzer, for example a traversal that visits a node
+// twice. The check is independent of 'want' matching: a duplicate is
+// reported even if the test data expects it.
+func WithNoDuplicates() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.noDups = true
+	})
+}
+
+// WithCoverage causes the Runner to record in cov, during each Run, the
+// positions at which the analyzer reports diagnostics in the packages
+// under test, and the syntax nodes that enclose them, so that a test
+// can check the completeness of the analyzer. Each Run replaces the
+// previous contents of cov. See Coverage for the limitations of the
+// recording.
+func WithCoverage(cov *Coverage) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.coverage = cov
+	})
+}
+
+// WithAnchoredPatterns causes the Runner to anchor the regular
+// expression of each expectation at both ends, so that it must match
+// the whole of a diagnostic message or fact, not just part of it: with
+// the option, 'want "unused"' does not match the message "unused
+// variable x". By default, a pattern matches any message that contains
+// a match of it.
+func WithAnchoredPatterns() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.anchored = true
+	})
+}
+
+// WithFileSet causes the Runner to record the position information of
+// the packages it loads in fset, rather than in a new FileSet for each
+// Run. The packages of a single Run always share a FileSet, so the
+// positions of diagnostics in different packages can be compared; with
+// the option, so can those of different Runs, and a test can interpret
+// the positions of the results of a Run, such as those of a
+// whole-program analyzer, without referring to a Pass.
+func WithFileSet(fset *token.FileSet) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.fset = fset
+	})
+}
+
+// RequireCategory causes the Runner to report an error for each
+// diagnostic that has no Category, which enforces the policy of a suite
+// of analyzers whose diagnostics must all be categorized, for example so
+// that they can be suppressed by category.
+func RequireCategory() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.category = true
+	})
+}
+
+// WithJSONRoundTrip causes the Runner to check the 'want' comments of
+// each package against its diagnostics as they appear after a round
+// trip through the JSON output format of drivers such as unitchecker,
+// rather than against the diagnostics reported by the analyzer. This
+// catches diagnostics that do not survive serialization, for example
+// because their messages are not valid UTF-8 or their positions are
+// invalid. The JSON form has no end positions or suggested fixes, so
+// checks of them, such as WithNarrowestNode, do not apply.
+func WithJSONRoundTrip() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.roundTripJSON = true
+	})
+}
+
+// WithSidecarUpdate, if update is set, causes the Runner to regenerate
+// the sidecar file of each source file that has one, such as
+// foo.go.want for foo.go, so that it expects exactly the diagnostics
+// reported in the source file, before checking expectations. The
+// sidecar files of a package hold the expectations of source files
+// that cannot be annotated with 'want' comments, such as generated
+// files; see Run. Typically, update is the value of a test flag, as
+// for WithGoldenReport.
+func WithSidecarUpdate(update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.updateSidecars = update
+	})
+}
+
+// WithStress causes the Runner, after analyzing the packages under test,
+// to analyze them n more times, concurrently, and to report an error
+// for each analysis whose outcome, its error or its diagnostics,
+// differs from that of the first. Since the analyses share the syntax
+// trees and type information of the packages, this checks that an
+// analyzer can be run safely by a driver that runs analyzers in
+// parallel. Races are best detected by running the test with -race. A
+// panic in an analyzer is reported as an error of its analysis, rather
+// than crashing the test.
+func WithStress(n int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.stress = n
+	})
+}
+
+// WithNoDuplicateFacts causes the Runner to report an error for each
+// fact that the analyzer exports more than once, with the same type,
+// for the same object or package, during its analysis of a package
+// under test. Each export replaces the previous fact, so a duplicate is
+// otherwise invisible, but usually indicates a bug in the analyzer.
+func WithNoDuplicateFacts() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.noDupFacts = true
+	})
+}
+
+// WithNodeBudget causes the Runner to report an error for each package
+// under test whose syntax nodes the analyzer visited, in all, more than
+// factor times the number of nodes in the package, which may indicate
+// that the analyzer traverses the package repeatedly, with a cost that
+// grows faster than the package. It guards against performance
+// regressions of analyzers whose traversal should be linear. Only the
+// traversals by the analyzer of an inspector.Inspector that it
+// requires, such as the result of the inspect pass, are counted, each
+// as a visit of every node of the package, even if it prunes subtrees;
+// a traversal by ast.Inspect or ast.Walk is not.
+func WithNodeBudget(factor int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.nodeBudget = factor
+	})
+}
+
+// MaxParallel causes the Runner to apply at most n analyzers to
+// packages at once, counting the analyzers that the analyzer requires
+// and its analyses of the dependencies of the packages under test. If n
+// is not positive, or by default, the limit is runtime.GOMAXPROCS(0).
+// A higher limit may shorten the analysis of many packages, but makes
+// its memory use grow with the number of packages analyzed at once; a
+// limit of 1 makes the analyses sequential, which may help in reading
+// the output of an analyzer that logs its progress. Loading is not
+// limited: it is done by a single invocation of the go command. With
+// WithStress, the limit applies to each of the analyses separately.
+func MaxParallel(n int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.maxParallel = n
+	})
+}
+
+// WithCodePattern sets the rule by which the Runner extracts the code
+// of a diagnostic's message, such as "SA1000", for comparison with a
+// 'code:"SA1000"' expectation: the code is the text matched by the
+// first parenthesized subexpression of rx. By default, the code is
+// that in brackets at the start of the message, as in "[SA1000] text".
+// A message that rx does not match has no code, and matches no 'code:'
+// expectation.
+func WithCodePattern(rx *regexp.Regexp) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.codePattern = rx
+	})
+}
+
+// WithProfiling causes the Runner to write a CPU profile of the
+// analysis of the packages under test to the file cpuprofile, and a
+// memory profile, taken when the analysis is complete, to the file
+// memprofile, in the format of the runtime/pprof package, for
+// inspection by 'go tool pprof'. Either name may be empty, to skip that
+// profile. The profiles cover the analyses of all the packages, and
+// their dependencies, but not the loading of the packages or the
+// checking of the results. Only one CPU profile may be written at a
+// time, so a test that uses this option must not run in parallel with
+// another that does, nor be run with the -cpuprofile flag.
+func WithProfiling(cpuprofile, memprofile string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.cpuProfile = cpuprofile
+		cfg.memProfile = memprofile
+	})
+}
+
+// WithIDPattern sets the rule by which the Runner extracts the rule ID
+// of a diagnostic's message, for comparison with an 'id:R1234'
+// expectation: the ID is the text matched by the first parenthesized
+// subexpression of rx. Unlike the code of a 'code:"code"' expectation,
+// there is no default rule, as the form of IDs varies between linters;
+// an 'id:' expectation is an error without this option. For example,
+// with the pattern `\(rule (\w+)\)`, the message "shadowed variable
+// (rule R1234)" has the ID R1234.
+func WithIDPattern(rx *regexp.Regexp) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.idPattern = rx
+	})
+}
+
+// RecordPackages causes the Runner to write a record of the packages
+// that it loads, including all their dependencies, to the file
+// filename, from which ReplayPackages can load the same packages
+// again without running the go command. The record holds the names of
+// the files of the packages, not their contents, but also a hash of
+// each file, so that a replay can detect that the record is stale.
+// A test may record its packages when run with a flag, such as
+// -update, and otherwise replay them:
+//
+//	opt := analysistest.ReplayPackages(file)
+//	if *update {
+//		opt = analysistest.RecordPackages(file)
+//	}
+func RecordPackages(filename string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.record = filename
+	})
+}
+
+// ReplayPackages causes the Runner to load packages from the record
+// in the file filename, written by RecordPackages, instead of running
+// the go command, which makes the test faster and independent of the
+// environment. Loading fails if the record is stale: if it is of other
+// patterns, or if a file of the packages has changed since it was
+// made; the record must then be made again. Options that affect the
+// go command, such as WithBuildTags, take effect only when recording.
+func ReplayPackages(filename string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.replay = filename
+	})
+}
+
+// WithTAPReport causes the Runner to write to w a report of the
+// outcome of the test of each package, in the Test Anything Protocol
+// (TAP) format, for consumption by a continuous integration system that
+// does not understand the output of the go test command. The analysis
+// of each package is a test, which fails if any error is reported for
+// it; each such error is also included in the report, as a diagnostic
+// line. Errors are still reported to the Testing as usual.
+func WithTAPReport(w io.Writer) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.tapReport = w
+	})
+}
+
+// WithJUnitReport is like WithTAPReport, but writes the report in the
+// JUnit XML format: a test suite, named after the analyzer, in which
+// each package is a test case, with a failure for each error reported
+// for it.
+func WithJUnitReport(w io.Writer) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.junitReport = w
+	})
+}
+
+// WithMaxAlloc causes the Runner to report an error if the analysis of
+// the packages under test, including their dependencies, allocates more
+// than the given number of bytes in all, as measured by the TotalAlloc
+// statistic of runtime.ReadMemStats. It is a coarse guard against an
+// analyzer whose memory use grows faster than the packages it analyzes.
+// The measure includes the allocations of every goroutine, so it is
+// only advisory if other tests run in parallel, and the limit should
+// allow a generous margin over the usual allocations of the analysis.
+func WithMaxAlloc(bytes uint64) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.maxAlloc = bytes
+	})
+}
+
+// WithWantUpdate, if update is set, causes the Runner to insert a
+// 'want' comment at the end of each line of a Go file under test on
+// which diagnostics are reported but which has no 'want' comment,
+// expecting exactly those diagnostics, before checking expectations.
+// It is an aid to writing the test data of a new analyzer: its author
+// may start from the actual diagnostics, then review and refine the
+// comments. Lines that already have a 'want' comment are left alone,
+// so the update may be repeated. A line that ends within a multi-line
+// string literal or comment cannot be annotated, and is reported as an
+// error. Typically, update is the value of a test flag, as for
+// WithGoldenReport.
+func WithWantUpdate(update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.updateWants = update
+	})
+}
+
+// WithGoFlags causes the Runner to load the packages under test with
+// the GOFLAGS environment variable set to flags, such as "-mod=mod" or
+// "-trimpath", in place of any value inherited from the environment,
+// to reproduce the environment of a user. It is an escape hatch for
+// behaviors of the go command that no other option controls. Each of
+// the space-separated flags must begin with a hyphen; if loading fails,
+// the error mentions the flags, which may be the cause.
+func WithGoFlags(flags string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.goflags = flags
+	})
+}
+
+// WithGOOS causes the Runner to load the packages under test as if the
+// GOOS environment variable were set to goos, such as "windows",
+// whatever the host, so that files are selected by their file names
+// and build constraints for that operating system, and only their
+// 'want' comments are checked. See also RunPlatforms.
+func WithGOOS(goos string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.goos = goos
+	})
+}
+
+// WithGOARCH causes the Runner to load the packages under test as if
+// the GOARCH environment variable were set to goarch, such as "arm64",
+// whatever the host, just as WithGOOS does for the operating system.
+func WithGOARCH(goarch string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.goarch = goarch
+	})
+}
+
+// WithSuppression causes the Runner to report an error for each
+// diagnostic on a line suppressed by a comment that begins with the
+// directive, such as "//nolint" or "//lint:ignore", to check that an
+// analyzer honors the suppression convention of its ecosystem. If
+// nextLine is set, a directive suppresses the line that follows it,
+// as "//lint:ignore" does; otherwise it suppresses its own line, as
+// "//nolint" does. The check is independent of 'want' matching: a
+// suppressed diagnostic is reported even if the test data expects it.
+// See also the expectation 'want none'.
+func WithSuppression(directive string, nextLine bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.suppress = directive
+		cfg.suppressNext = nextLine
+	})
+}
+
+// WithJSONGolden causes the Runner to compare the diagnostics of each
+// package, in JSON form, against the golden file dir/path.findings.json,
+// where dir is the test directory and path is the package path, in
+// place of 'want' comments, which are unwieldy for an analyzer that
+// reports many diagnostics. The file holds an array of diagnostics in
+// the form of the -json output of drivers, with positions relative to
+// the test directory, sorted as by NormalizeFindings:
+//
+//	[
+//		{
+//			"posn": "a/a.go:4:2",
+//			"message": "call of print"
+//		}
+//	]
+//
+// The diagnostics of a package and its test variant are combined.
+// 'want' comments of diagnostics are not checked, so a package must not
+// have any, but those of facts are checked as usual.
+//
+// If update is set, the Runner instead writes the golden files.
+// Typically, its value is that of a test flag, as for WithGoldenReport.
+func WithJSONGolden(update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.jsonGolden = true
+		cfg.updateJSON = update
+	})
+}
+
+// WithWantPrefixes causes the Runner to recognize the expectations of
+// the comments of the packages with the import paths that are keys of
+// prefixes by the corresponding words, in place of "want". A tree of
+// test data that is shared by several analyzers may then annotate each
+// package for a different analyzer, such as 'printf:' for one and
+// 'shadow:' for another, so that the annotations of one analyzer are
+// not mistaken for those of another:
+//
+//	fmt.Printf("%d", "s") // printf: "wrong type"
+//
+// The prefixes also apply to sidecar files and to the comments added
+// by WithWantUpdate. The external test package of a package p is a
+// distinct key, p_test. The comments of other packages begin with
+// "want" as usual.
+func WithWantPrefixes(prefixes map[string]string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.wantPrefixes = prefixes
+	})
+}
+
+// WithMaxFindings causes the Runner to report an error, in place of
+// checking expectations, for each package for which the analyzer
+// reports more than n diagnostics, listing the first few. It guards
+// against a runaway analyzer, such as one that reports the same node
+// repeatedly, whose thousands of unexpected diagnostics would make the
+// output of the test unreadable. By default, there is no maximum.
+func WithMaxFindings(n int) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.maxFindings = n
+	})
+}
+
+// A Checker applies an analyzer to packages, and to their dependencies
+// as the analyzer requires, and returns a Result for each of the
+// packages; see WithChecker.
+type Checker func(a *analysis.Analyzer, pkgs []*packages.Package) []*Result
+
+// WithChecker causes the Runner to apply analyzers using check, in
+// place of the checker of the go/analysis drivers, so that another
+// execution engine, such as an experimental scheduler, may be tested
+// against the test data of existing analyzers. The Runner's options
+// that control the execution of analyzers, such as WithImportedFact,
+// WithNoDuplicateFacts, and MaxParallel, do not affect check; options
+// that affect loading and the checking of results do.
+func WithChecker(check Checker) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.checker = check
+	})
+}
+
+// WithResultGolden causes the Runner to compare the result of the
+// analyzer for each package, the value that its Run function returns
+// for use by other analyzers, against the golden file
+// dir/path.result.golden, where dir is the test directory and path is
+// the package path. It tests an analyzer whose product is data, such as
+// one that is used as a library, as 'want' comments test diagnostics.
+// The results of the test variants of packages are not compared.
+//
+// The golden file holds the result as formatted by format, which should
+// be deterministic and should not include positions or pointers, or,
+// if format is nil, by the %+v verb of package fmt, followed by a
+// newline. A difference is reported as a unified diff.
+//
+// If update is set, the Runner instead writes the golden files.
+// Typically, its value is that of a test flag, as for WithGoldenReport.
+func WithResultGolden(format func(interface{}) []byte, update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.resultGolden = true
+		cfg.updateResult = update
+		cfg.formatResult = format
+	})
+}
+
+// WithSnapshotFile causes the Runner to compare the diagnostics of all
+// the packages under test, in the form that WithSnapshot writes, with
+// the snapshot file, and to report any difference as a unified diff.
+// A relative file name is relative to the test directory. If the file
+// does not exist, the Runner creates it, and the first run passes.
+//
+// Unlike the golden files of WithGoldenReport, which are written for
+// each package of the test data, a snapshot records whatever the
+// analyzer reports on the test data that exist, as a guard against
+// unintended changes of behavior, for example during a refactoring.
+// The 'want' comments of the packages are checked as usual.
+//
+// If update is set, the Runner instead writes the snapshot file, to
+// accept a change. Typically, its value is that of a test flag, as for
+// WithGoldenReport.
+func WithSnapshotFile(file string, update bool) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.snapshotFile = file
+		cfg.updateSnapshot = update
+	})
+}
+
+// WithExportedOnly causes the Runner to consider only the diagnostics
+// within exported declarations, or outside any declaration, for an
+// analyzer of the API of packages whose tests would otherwise need
+// 'want' comments for its diagnostics within unexported ones. A
+// declaration is exported if it declares an exported type, function,
+// variable, or constant, or an exported method of an exported type.
+// The diagnostics within unexported declarations are neither matched
+// against expectations nor reported as unexpected, but, unlike those
+// filtered out by WithFindingFilter, still appear in reports such as
+// that of WithGoldenReport.
+func WithExportedOnly() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.exportedOnly = true
+	})
+}
+
+// WithEnabledChecks causes the Runner to apply each analyzer with only
+// the named sub-checks enabled, so that each check of an analyzer that
+// bundles several can be tested in isolation. By convention, each
+// boolean flag of such an analyzer enables a sub-check of the same
+// name, whose diagnostics have that name as their Category. The Runner
+// sets each boolean flag to whether it is named by checks for the
+// duration of the Run, and reports as an error each diagnostic whose
+// category names a disabled check, as well as each name of checks that
+// is not a boolean flag of the analyzer.
+//
+// Because flags are global to an Analyzer, tests that use this option
+// must not run the same analyzer in parallel.
+func WithEnabledChecks(checks ...string) Option {
+	return optionSetter(func(cfg *config) {
+		cfg.enabledChecks = append([]string{}, checks...)
+	})
+}
+
+// WithNoFindingsInText causes the Runner to report an error for each
+// diagnostic whose position is within a comment or a literal, such as a
+// string, rather than at its start, for an analyzer that must not report
+// on such text, but that scans the text of files, where a mistake can
+// let it match the contents of a comment or string. The error quotes the
+// comment or literal. The check is independent of 'want' matching.
+func WithNoFindingsInText() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.noInText = true
+	})
+}
+
+// WithRegions causes the Runner to confine the diagnostics of an
+// analyzer to regions of each test file that marks them, each of which
+// begins with a "// BEGIN" comment and ends with a "// END" comment. A
+// diagnostic that is reported outside the regions of such a file is
+// reported as an error, even if it is expected, as is a marker that
+// does not begin or end a region. Files without markers are not
+// checked.
+//
+//	// BEGIN
+//	func f() { print() } // want "call of print"
+//	// END
+func WithRegions() Option {
+	return optionSetter(func(cfg *config) {
+		cfg.regions = true
+	})
+}
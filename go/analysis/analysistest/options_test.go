@@ -0,0 +1,896 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/internal/checker"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestSyntaxOnly(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+import "fmt"
+
+func f() { // want "f"
+	fmt.Println(undefined)
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The type error is not detected, as types are not loaded.
+	results := analysistest.NewRunner(analysistest.WithSyntaxOnly()).Run(t, dir, funcdecl, "a")
+	for _, result := range results {
+		if result.Pass.TypesInfo != nil {
+			t.Errorf("%s: got type information, want none", result.Pass)
+		}
+	}
+
+	// A use of type information is reported.
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithSyntaxOnly()).Run(t2, dir, typedcall, "a")
+	want := "error analyzing typedcall@a: analyzer panicked: runtime error: invalid memory address or nil pointer dereference (with WithSyntaxOnly, the analyzer must not use type information)"
+	if len(t2.errors) != 1 || t2.errors[0] != want {
+		t.Errorf("got errors %q, want %q", t2.errors, want)
+	}
+}
+
+func TestTimingReport(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {} // want "f"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithTimingReport()).Run(t2, dir, funcdecl, "a")
+	if len(t2.errors) > 0 {
+		t.Errorf("unexpected errors:\n%s", strings.Join(t2.errors, "\n"))
+	}
+	if len(t2.logs) != 1 {
+		t.Fatalf("got %d log messages, want 1", len(t2.logs))
+	}
+	lines := strings.Split(t2.logs[0], "\n")
+	if !strings.HasPrefix(lines[0], "loaded packages in ") || len(lines) != 2 || !strings.HasSuffix(lines[1], "\ta") {
+		t.Errorf("unexpected timing report:\n%s", t2.logs[0])
+	}
+}
+
+func TestTrimmedMessages(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {} // want " ^padded$ "
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	padded := &analysis.Analyzer{
+		Name: "padded",
+		Doc:  "report each file with a padded message",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				pass.Reportf(f.Decls[0].Pos(), " padded\n")
+			}
+			return nil, nil
+		},
+	}
+
+	// By default, white space is significant.
+	t2 := new(logger)
+	analysistest.Run(t2, dir, padded, "a")
+	if len(t2.errors) == 0 {
+		t.Errorf("Run succeeded despite white space in message")
+	}
+
+	analysistest.NewRunner(analysistest.WithTrimmedMessages()).Run(t, dir, padded, "a")
+}
+
+func TestNonGoFiles(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+`,
+		"a/config.yaml": `# Configuration.
+good: true
+bad: true # want "bad key"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// yaml reports each "bad" key in the config.yaml
+	// file in the package directory.
+	yaml := &analysis.Analyzer{
+		Name: "yaml",
+		Doc:  "report bad keys in config.yaml",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			dir := filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+			filename := filepath.Join(dir, "config.yaml")
+			content, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			tf := pass.Fset.AddFile(filename, -1, len(content))
+			tf.SetLinesForContent(content)
+			for i, line := range strings.Split(string(content), "\n") {
+				if strings.HasPrefix(line, "bad:") {
+					pass.Reportf(tf.LineStart(i+1), "bad key")
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	// Without the option, the diagnostic is unexpected.
+	t2 := new(logger)
+	analysistest.Run(t2, dir, yaml, "a")
+	if want := "a/config.yaml:3:1: unexpected diagnostic: bad key"; len(t2.errors) != 1 || t2.errors[0] != want {
+		t.Errorf("got errors %q, want %q", t2.errors, want)
+	}
+
+	analysistest.NewRunner(analysistest.WithNonGoFiles(".yaml", "#")).Run(t, dir, yaml, "a")
+}
+
+func TestFindingFilter(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // no expectation for the "style" category
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// categories reports calls of print in the "bug"
+	// category and of println in the "style" category.
+	categories := &analysis.Analyzer{
+		Name: "categories",
+		Doc:  "report print calls in two categories",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if id, ok := call.Fun.(*ast.Ident); ok {
+							category := "bug"
+							if id.Name == "println" {
+								category = "style"
+							}
+							pass.Report(analysis.Diagnostic{
+								Pos:      call.Pos(),
+								Category: category,
+								Message:  "call of " + id.Name,
+							})
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+
+	// Without a filter, the "style" diagnostic is unexpected.
+	t2 := new(logger)
+	analysistest.Run(t2, dir, categories, "a")
+	if want := "a/a.go:5:2: unexpected diagnostic: call of println"; len(t2.errors) != 1 || t2.errors[0] != want {
+		t.Errorf("got errors %q, want %q", t2.errors, want)
+	}
+
+	bugs := func(d *analysis.Diagnostic) bool { return d.Category == "bug" }
+	analysistest.NewRunner(analysistest.WithFindingFilter(bugs)).Run(t, dir, categories, "a")
+}
+
+// typedcall reports each call whose function has a valid type.
+var typedcall = &analysis.Analyzer{
+	Name: "typedcall",
+	Doc:  "report calls of functions of known type",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if tv, ok := pass.TypesInfo.Types[call.Fun]; ok && tv.Type != types.Typ[types.Invalid] {
+						pass.Reportf(call.Pos(), "call of %v", tv.Type)
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestTypeErrors(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	g()         // want "call of func\\(\\)"
+	undefined() // a type error
+}
+
+func g() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// By default, the analyzer does not run.
+	t2 := new(logger)
+	analysistest.Run(t2, dir, typedcall, "a")
+	if want := "error analyzing typedcall@a: analysis skipped due to errors in package"; len(t2.errors) != 1 || t2.errors[0] != want {
+		t.Errorf("got errors %q, want %q", t2.errors, want)
+	}
+
+	analysistest.NewRunner(analysistest.WithTypeErrors()).Run(t, dir, typedcall, "a")
+}
+
+func TestRunDespiteErrors(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	f() // want "call of func\\(\\)"
+}
+`,
+		"b/b.go": `package b
+
+func g() {
+	g()         // want "call of func\\(\\)"
+	undefined() // a type error
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// If disabled, package b is excluded.
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithRunDespiteErrors(false)).Run(t2, dir, typedcall, "a", "b")
+	if t2.errors != nil {
+		t.Errorf("got errors %q, want none", t2.errors)
+	}
+	if want := "excluding package b, which has errors"; len(t2.logs) != 1 || t2.logs[0] != want {
+		t.Errorf("got logs %q, want %q", t2.logs, want)
+	}
+
+	// If enabled, it is analyzed.
+	analysistest.NewRunner(analysistest.WithRunDespiteErrors(true)).Run(t, dir, typedcall, "a", "b")
+}
+
+func TestBuildTags(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"a/a_foo.go": `//go:build foo
+// +build foo
+
+package a
+
+func g() {
+	println() // want "call of println"
+}
+`,
+		"a/a_notfoo.go": `//go:build !foo
+// +build !foo
+
+package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithBuildTags("foo")).Run(t, dir, printcall, "a")
+	analysistest.RunMatrix(t, dir, printcall, "a", [][]string{nil, {"foo"}, {"foo", "bar"}})
+}
+
+func TestPlatforms(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	g()
+}
+`,
+		"a/a_linux.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+		"a/a_windows.go": `package a
+
+func g() {
+	println() // want "call of println"
+}
+`,
+		"a/a_other.go": `//go:build !linux && !windows
+// +build !linux,!windows
+
+package a
+
+func g() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Each platform selects its own stub.
+	var buf bytes.Buffer
+	r := analysistest.NewRunner(analysistest.WithSnapshot(&buf))
+	r.RunPlatforms(t, dir, printcall, "a", []string{"linux/amd64", "windows/386", "darwin/arm64"})
+	want := "a/a_linux.go:4:2: call of print\na/a_windows.go:4:2: call of println\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWantPackages(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go":      "package a\n",
+		"a/a_test.go": "package a\n",
+		"a/b/b.go":    "package b\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// a, a [a.test], a.test, and a/b.
+	analysistest.NewRunner(analysistest.WantPackages(4)).Run(t, dir, printcall, "a/...")
+
+	// a/c/... matches nothing.
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WantPackages(2)).Run(t2, dir, printcall, "a/b", "a/c/...")
+	if want := `loading [a/b a/c/...]: got 1 packages ["a/b"], want 2`; len(t2.errors) != 1 || t2.errors[0] != want {
+		t.Errorf("got errors %q, want %q", t2.errors, want)
+	}
+}
+
+func TestAnchoredPatterns(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// By default, a pattern matches part of a message.
+	analysistest.Run(t, dir, printcall, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithAnchoredPatterns()).Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go:5:2: diagnostic "call of println" does not match pattern "^(?:call of print)$"`,
+		`a/a.go:5: no diagnostic was reported matching "^(?:call of print)$"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() { print() } // want "call of print"
+`,
+		"b/b.go": `package b
+
+func g() { println() } // want "call of println"
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The packages of one Run share a FileSet.
+	results := analysistest.Run(t, dir, printcall, "a", "b")
+	if len(results) != 2 || results[0].Pass.Fset != results[1].Pass.Fset {
+		t.Fatalf("packages of a Run do not share a FileSet")
+	}
+
+	// With WithFileSet, so do those of different Runs.
+	fset := token.NewFileSet()
+	r := analysistest.NewRunner(analysistest.WithFileSet(fset))
+	var positions []token.Pos
+	for _, pkg := range []string{"a", "b"} {
+		for _, result := range r.Run(t, dir, printcall, pkg) {
+			if result.Pass.Fset != fset {
+				t.Errorf("package %s was not loaded into the FileSet", pkg)
+			}
+			for _, d := range result.Diagnostics {
+				positions = append(positions, d.Pos)
+			}
+		}
+	}
+	var got []string
+	for _, pos := range positions {
+		posn := fset.Position(pos)
+		got = append(got, fmt.Sprintf("%s:%d:%d", filepath.Base(posn.Filename), posn.Line, posn.Column))
+	}
+	if want := []string{"a.go:3:12", "b.go:3:12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got positions %q, want %q", got, want)
+	}
+}
+
+func TestMaxParallel(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	files := make(map[string]string)
+	var patterns []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files[name+"/"+name+".go"] = "package " + name + "\n"
+		patterns = append(patterns, name)
+	}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// busy records the greatest number of its
+	// analyses that run at once.
+	var mu sync.Mutex
+	var running, max int
+	busy := &analysis.Analyzer{
+		Name: "busy",
+		Doc:  "take some time",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+
+	analysistest.NewRunner(analysistest.MaxParallel(1)).Run(t, dir, busy, patterns...)
+	if max != 1 {
+		t.Errorf("with MaxParallel(1), %d analyses ran at once", max)
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	cpu := filepath.Join(dir, "cpu.prof")
+	mem := filepath.Join(dir, "mem.prof")
+	analysistest.NewRunner(analysistest.WithProfiling(cpu, mem)).Run(t, dir, printcall, "a")
+	for _, name := range []string{cpu, mem} {
+		if data, err := ioutil.ReadFile(name); err != nil {
+			t.Error(err)
+		} else if len(data) == 0 {
+			t.Errorf("profile %s is empty", filepath.Base(name))
+		}
+	}
+}
+
+func TestRecordPackages(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	files := map[string]string{
+		"a/a.go": `package a
+
+import "fmt"
+
+func f() {
+	print(fmt.Sprint()) // want "call of print"
+}
+`,
+	}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	record := filepath.Join(dir, "packages.json")
+	analysistest.NewRunner(analysistest.RecordPackages(record)).Run(t, dir, printcall, "a")
+
+	// The record may be replayed in another copy of the fixture.
+	dir2, cleanup2, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup2()
+	replay := analysistest.NewRunner(analysistest.ReplayPackages(record))
+	results := replay.Run(t, dir2, printcall, "a")
+	if len(results) != 1 || results[0].Package.ID != "a" {
+		t.Errorf("replay gave %d results, want 1 of package a", len(results))
+	}
+
+	// A change to the files makes it stale.
+	if err := ioutil.WriteFile(filepath.Join(dir2, "src", "a", "a.go"), []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	replay.Run(t2, dir2, printcall, "a")
+	want := fmt.Sprintf("loading [a]: recording %s is stale: $DIR/src/a/a.go has changed; record the packages again with RecordPackages", record)
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
+
+// sink keeps allocations alive.
+var sink []byte
+
+func TestMaxAlloc(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithMaxAlloc(1<<30)).Run(t, dir, printcall, "a")
+
+	// hog allocates 64MB.
+	hog := &analysis.Analyzer{
+		Name: "hog",
+		Doc:  "allocate a lot of memory",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			sink = make([]byte, 64<<20)
+			return nil, nil
+		},
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithMaxAlloc(32<<20)).Run(t2, dir, hog, "a")
+	sink = nil
+	if len(got) != 2 || !strings.HasPrefix(got[0], "analysis of [a] allocated ") || !strings.HasSuffix(got[0], " bytes, more than the limit of 33554432 set by WithMaxAlloc") {
+		t.Errorf("got errors %q, want one about the limit and an unmet expectation", got)
+	}
+}
+
+// A logger is a fake *testing.T that records errors and log messages.
+type logger struct {
+	errors, logs []string
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Logf(format string, args ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func TestGoFlags(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+		"a/a_foo.go": `//go:build foo
+// +build foo
+
+package a
+
+func g() {
+	println() // want "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.NewRunner(analysistest.WithGoFlags("-tags=foo -trimpath")).Run(t, dir, printcall, "a")
+
+	// Invalid flags, and failures that they may cause, are reported.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithGoFlags("tags=foo")).Run(t2, dir, printcall, "a")
+	analysistest.NewRunner(analysistest.WithGoFlags("-mod=bogus")).Run(t2, dir, printcall, "a")
+	if len(got) != 2 ||
+		got[0] != `loading [a]: invalid GOFLAGS "tags=foo": "tags=foo" is not a flag` ||
+		!strings.HasSuffix(got[1], `(with GOFLAGS="-mod=bogus")`) {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestGOOS(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	g()
+	h()
+}
+`,
+		"a/windows.go": `//go:build windows
+// +build windows
+
+package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+		"a/other.go": `//go:build !windows
+// +build !windows
+
+package a
+
+func g() {}
+`,
+		"a/arm64.go": `//go:build arm64
+// +build arm64
+
+package a
+
+func h() {
+	println() // want "call of println"
+}
+`,
+		"a/notarm64.go": `//go:build !arm64
+// +build !arm64
+
+package a
+
+func h() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var buf bytes.Buffer
+	r := analysistest.NewRunner(analysistest.WithGOOS("windows"), analysistest.WithGOARCH("arm64"), analysistest.WithSnapshot(&buf))
+	r.Run(t, dir, printcall, "a")
+	want := "a/arm64.go:7:2: call of println\na/windows.go:7:2: call of print\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWantPrefixes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // printcall: "call of print"
+	print() // want "call of println"
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	print() // want "call of print"
+	print() // printcall: "call of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The 'want' comments of a are ignored, as are the
+	// 'printcall:' comments of b.
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	r := analysistest.NewRunner(analysistest.WithWantPrefixes(map[string]string{"a": "printcall:"}))
+	r.Run(t2, dir, printcall, "a", "b")
+	want := []string{
+		`a/a.go:5:2: unexpected diagnostic: call of print`,
+		`b/b.go:5:2: unexpected diagnostic: call of print`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMaxFindings(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()   // want "call of print"
+	println() // want "call of println"
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	print()
+	print()
+	print()
+	print()
+	print()
+	print()
+	print()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithMaxFindings(2)).Run(t2, dir, printcall, "a", "b")
+	want := []string{
+		`analysis of b reported 7 diagnostics, more than the maximum of 2; the first are:
+	b/b.go:4:2: call of print
+	b/b.go:5:2: call of print
+	b/b.go:6:2: call of print
+	b/b.go:7:2: call of print
+	b/b.go:8:2: call of print
+	...`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestChecker(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// A checker that delegates to the standard one passes.
+	calls := 0
+	delegate := func(a *analysis.Analyzer, pkgs []*packages.Package) []*analysistest.Result {
+		calls++
+		return checker.TestAnalyzer(a, pkgs)
+	}
+	analysistest.NewRunner(analysistest.WithChecker(delegate)).Run(t, dir, printcall, "a")
+	if calls != 1 {
+		t.Errorf("checker was called %d times, want 1", calls)
+	}
+
+	// A checker that loses diagnostics fails.
+	lossy := func(a *analysis.Analyzer, pkgs []*packages.Package) []*analysistest.Result {
+		results := checker.TestAnalyzer(a, pkgs)
+		for _, res := range results {
+			res.Diagnostics = nil
+		}
+		return results
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.NewRunner(analysistest.WithChecker(lossy)).Run(t2, dir, printcall, "a")
+	want := []string{`a/a.go:4: no diagnostic was reported matching "call of print"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// reportTiming logs the time spent loading and analyzing packages,
+// and a breakdown by package, slowest first.
+func reportTiming(t Testing, loadTime, analyzeTime time.Duration, results []*Result) {
+	sorted := make([]*Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "loaded packages in %v; analyzed %d packages in %v", loadTime, len(results), analyzeTime)
+	for _, result := range sorted {
+		fmt.Fprintf(&buf, "\n\t%v\t%s", result.Duration, result.Package.ID)
+	}
+	logf(t, "%s", buf.String())
+}
+
+// startProfiling starts a CPU profile, written to the file cpuprofile,
+// if it is non-empty. It returns a function that stops the CPU profile
+// and, if memprofile is non-empty, writes a memory profile to it.
+// Errors are reported to t.
+func startProfiling(t Testing, cpuprofile, memprofile string) (stop func()) {
+	var cpu *os.File
+	if cpuprofile != "" {
+		f, err := os.Create(cpuprofile)
+		if err != nil {
+			t.Errorf("creating CPU profile: %v", err)
+		} else if err := pprof.StartCPUProfile(f); err != nil {
+			t.Errorf("starting CPU profile: %v", err)
+			f.Close()
+		} else {
+			cpu = f
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				t.Errorf("writing CPU profile: %v", err)
+			}
+		}
+		if memprofile != "" {
+			f, err := os.Create(memprofile)
+			if err != nil {
+				t.Errorf("creating memory profile: %v", err)
+				return
+			}
+			runtime.GC() // get up-to-date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				t.Errorf("writing memory profile: %v", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Errorf("writing memory profile: %v", err)
+			}
+		}
+	}
+}
+
+// measureAlloc returns a function that returns
+// the number of bytes allocated since the call.
+func measureAlloc() func() uint64 {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	return func() uint64 {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+}
+
+// A SizedGenerator returns the files of test data of size n, in the
+// form of the argument of WriteFiles, for CheckLinear. The size of the
+// data, such as its number of declarations or statements, should be
+// proportional to n.
+type SizedGenerator func(n int) map[string]string
+
+// scaleRuns is the number of times that CheckLinear analyzes the test
+// data of each size; the fastest time is used, to reduce noise.
+const scaleRuns = 3
+
+// CheckLinear asserts that the time an analyzer takes grows no faster
+// than linearly with the size of its input, to catch an accidentally
+// quadratic algorithm. For each of the sizes, it writes the test data
+// that generate returns, and applies the analysis to the packages
+// denoted by patterns, checking their 'want' comments as Run does. It
+// then fits the analysis times, excluding loading, to a power of the
+// size, n^k, and reports an error if the order k exceeds 1+tolerance.
+// The estimated order is logged in any case.
+//
+// The sizes must include at least two distinct values, and should be
+// large enough, and the test data of the largest far enough larger than
+// that of the smallest, that the differences in times are not noise.
+// A tolerance of 0.5 distinguishes linear from quadratic growth.
+func CheckLinear(t Testing, a *analysis.Analyzer, generate SizedGenerator, sizes []int, tolerance float64, patterns ...string) {
+	NewRunner().CheckLinear(t, a, generate, sizes, tolerance, patterns...)
+}
+
+// CheckLinear behaves like the package-level CheckLinear function, but
+// uses the Runner's configuration.
+func (r *Runner) CheckLinear(t Testing, a *analysis.Analyzer, generate SizedGenerator, sizes []int, tolerance float64, patterns ...string) {
+	times := make([]time.Duration, len(sizes))
+	for i, n := range sizes {
+		dir, cleanup, err := WriteFiles(generate(n))
+		if err != nil {
+			t.Errorf("writing test data of size %d: %v", n, err)
+			return
+		}
+		for run := 0; run < scaleRuns; run++ {
+			var d time.Duration
+			for _, result := range r.Run(t, dir, a, patterns...) {
+				d += result.Duration
+			}
+			if run == 0 || d < times[i] {
+				times[i] = d
+			}
+		}
+		cleanup()
+	}
+
+	k, ok := fitOrder(sizes, times)
+	if !ok {
+		t.Errorf("CheckLinear of %s needs at least two distinct positive sizes, not %v", a, sizes)
+		return
+	}
+	if k > 1+tolerance {
+		t.Errorf("analysis time of %s grows as O(n^%.2f), faster than linearly, for sizes %v: %v", a, k, sizes, times)
+	} else {
+		logf(t, "analysis time of %s grows as O(n^%.2f) for sizes %v: %v", a, k, sizes, times)
+	}
+}
+
+// fitOrder returns the exponent k of the power law t = c*n^k that best
+// fits the times of the sizes, by least squares on their logarithms.
+// It reports false if there are not two distinct positive sizes.
+func fitOrder(sizes []int, times []time.Duration) (k float64, ok bool) {
+	var xs, ys []float64
+	for i, n := range sizes {
+		if n <= 0 {
+			continue
+		}
+		d := times[i]
+		if d <= 0 {
+			d = 1 // avoid log(0)
+		}
+		xs = append(xs, math.Log(float64(n)))
+		ys = append(ys, math.Log(float64(d)))
+	}
+	var xmean, ymean float64
+	for i := range xs {
+		xmean += xs[i] / float64(len(xs))
+		ymean += ys[i] / float64(len(ys))
+	}
+	var sxy, sxx float64
+	for i := range xs {
+		sxy += (xs[i] - xmean) * (ys[i] - ymean)
+		sxx += (xs[i] - xmean) * (xs[i] - xmean)
+	}
+	if sxx == 0 {
+		return 0, false
+	}
+	return sxy / sxx, true
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// sleepy returns an analyzer that reports nothing, but sleeps for unit
+// times the number of calls in the package raised to the power order,
+// to simulate an algorithm of that complexity.
+func sleepy(order int, unit time.Duration) *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name: fmt.Sprintf("sleepy%d", order),
+		Doc:  "sleep according to the number of calls",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			calls := 0
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if _, ok := n.(*ast.CallExpr); ok {
+						calls++
+					}
+					return true
+				})
+			}
+			d := unit
+			for i := 0; i < order; i++ {
+				d *= time.Duration(calls)
+			}
+			time.Sleep(d)
+			return nil, nil
+		},
+	}
+}
+
+func TestCheckLinear(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	calls := func(n int) map[string]string {
+		return map[string]string{
+			"a/a.go": "package a\n\nfunc f() {\n" + strings.Repeat("\tprint()\n", n) + "}\n",
+		}
+	}
+	sizes := []int{10, 20, 40}
+
+	analysistest.CheckLinear(t, sleepy(1, 200*time.Microsecond), calls, sizes, 0.5, "a")
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.CheckLinear(t2, sleepy(2, 10*time.Microsecond), calls, sizes, 0.5, "a")
+	if len(got) != 1 || !strings.Contains(got[0], "analysis time of sleepy2 grows as O(n^") || !strings.Contains(got[0], "faster than linearly") {
+		t.Errorf("got errors %q, want one of quadratic growth", got)
+	}
+
+	got = nil
+	analysistest.CheckLinear(t2, sleepy(1, 200*time.Microsecond), calls, []int{5, 5}, 0.5, "a")
+	if want := "CheckLinear of sleepy1 needs at least two distinct positive sizes, not [5 5]"; len(got) != 1 || got[0] != want {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
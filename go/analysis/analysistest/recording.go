@@ -0,0 +1,152 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/internal/packagesinternal"
+)
+
+// This file defines the recording of loaded packages, and their
+// replay in place of the go command; see RecordPackages.
+
+// A recording is the record of a load of packages. Its Sizes, Roots,
+// and Packages fields form the response of a go/packages driver, in
+// the format used by GOPACKAGESDRIVER programs.
+//
+// The names of files within the directory of the test, and within
+// GOROOT, are recorded relative to them, as "$DIR/..." and
+// "$GOROOT/...", so that a recording of a fixture written by
+// WriteFiles, whose directory varies, can be replayed.
+type recording struct {
+	Patterns []string          // the patterns that were loaded
+	Files    map[string]string // maps each file to the SHA-256 hash of its contents
+	Sizes    *types.StdSizes   `json:",omitempty"`
+	Roots    []string          // the IDs of the packages that matched the patterns
+	Packages []*packages.Package
+}
+
+// recordPackages writes a recording of pkgs, loaded from the patterns
+// in dir, to the file filename.
+func recordPackages(filename, dir string, patterns []string, pkgs []*packages.Package) error {
+	rec := &recording{
+		Patterns: patterns,
+		Files:    make(map[string]string),
+	}
+	if len(pkgs) > 0 {
+		rec.Sizes, _ = pkgs[0].TypesSizes.(*types.StdSizes)
+	}
+	for _, pkg := range pkgs {
+		rec.Roots = append(rec.Roots, pkg.ID)
+	}
+	var err error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		saved := *pkg
+		for _, names := range []*[]string{&saved.GoFiles, &saved.CompiledGoFiles, &saved.OtherFiles, &saved.IgnoredFiles} {
+			abbreviated := make([]string, len(*names))
+			for i, name := range *names {
+				abbreviated[i] = abbreviate(dir, name)
+				if _, ok := rec.Files[abbreviated[i]]; !ok {
+					hash, herr := hashFile(name)
+					if herr != nil && err == nil {
+						err = herr
+					}
+					rec.Files[abbreviated[i]] = hash
+				}
+			}
+			*names = abbreviated
+		}
+		rec.Packages = append(rec.Packages, &saved)
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rec, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
+
+// replayPackages arranges for cfg to load the patterns in dir from the
+// recording in the file filename, without running the go command. It
+// returns an error if the recording is stale: if it was made of other
+// patterns, or if a file it mentions has changed since.
+func replayPackages(cfg *packages.Config, filename, dir string, patterns []string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return fmt.Errorf("reading recording %s: %v", filename, err)
+	}
+	if !reflect.DeepEqual(rec.Patterns, patterns) {
+		return fmt.Errorf("recording %s is stale: it is of patterns %q, not %q; record the packages again with RecordPackages", filename, rec.Patterns, patterns)
+	}
+	for name, hash := range rec.Files {
+		if got, err := hashFile(expand(dir, name)); err != nil || got != hash {
+			return fmt.Errorf("recording %s is stale: %s has changed; record the packages again with RecordPackages", filename, name)
+		}
+	}
+	for _, pkg := range rec.Packages {
+		for _, names := range [][]string{pkg.GoFiles, pkg.CompiledGoFiles, pkg.OtherFiles, pkg.IgnoredFiles} {
+			for i, name := range names {
+				names[i] = expand(dir, name)
+			}
+		}
+	}
+	response, err := json.Marshal(struct {
+		Sizes    *types.StdSizes `json:",omitempty"`
+		Roots    []string
+		Packages []*packages.Package
+	}{rec.Sizes, rec.Roots, rec.Packages})
+	if err != nil {
+		return err
+	}
+	packagesinternal.SetDriver(cfg, func(...string) ([]byte, error) { return response, nil })
+	return nil
+}
+
+// abbreviate returns the name of a file within dir or GOROOT
+// relative to it, using the prefix "$DIR/" or "$GOROOT/".
+func abbreviate(dir, name string) string {
+	for _, root := range []struct{ prefix, dir string }{{"$DIR", dir}, {"$GOROOT", runtime.GOROOT()}} {
+		if rel, err := filepath.Rel(root.dir, name); err == nil && !strings.HasPrefix(rel, "..") {
+			return root.prefix + "/" + filepath.ToSlash(rel)
+		}
+	}
+	return name
+}
+
+// expand is the inverse of abbreviate.
+func expand(dir, name string) string {
+	if rest := strings.TrimPrefix(name, "$DIR/"); rest != name {
+		return filepath.Join(dir, filepath.FromSlash(rest))
+	}
+	if rest := strings.TrimPrefix(name, "$GOROOT/"); rest != name {
+		return filepath.Join(runtime.GOROOT(), filepath.FromSlash(rest))
+	}
+	return name
+}
+
+// hashFile returns the SHA-256 hash of the contents of a file.
+func hashFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
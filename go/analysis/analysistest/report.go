@@ -0,0 +1,307 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/internal/lsp/diff"
+	"golang.org/x/tools/internal/lsp/diff/myers"
+)
+
+// NormalizeFindings returns a deterministic textual form of a set of
+// diagnostics, one line per diagnostic, sorted by position:
+//
+//	a/a.go:4:2: message
+//	a/a.go:7:2: [category] message
+//
+// File names are relative to dir (or dir/src, in GOPATH mode), so the
+// result does not depend on the location of the test data. It is
+// suitable for comparison against a golden file.
+func NormalizeFindings(dir string, fset *token.FileSet, diagnostics []analysis.Diagnostic) []string {
+	sorted := sortDiagnostics(dir, fset, diagnostics)
+	lines := make([]string, len(sorted))
+	for i, d := range sorted {
+		lines[i] = d.String()
+	}
+	return lines
+}
+
+// FindingsByFile returns the diagnostics of a result, grouped by the
+// name of the file in which each was reported, relative to dir (or
+// dir/src, in GOPATH mode), in order of position. It is a basis for
+// custom assertions about the diagnostics of a package, and for
+// views of where an analyzer reports diagnostics in the test data.
+//
+// The diagnostics are those of result.Diagnostics, not copies.
+func FindingsByFile(dir string, result *Result) map[string][]*analysis.Diagnostic {
+	byFile := make(map[string][]*analysis.Diagnostic)
+	for _, d := range sortDiagnostics(dir, result.Package.Fset, result.Diagnostics) {
+		byFile[d.posn.Filename] = append(byFile[d.posn.Filename], d.Diagnostic)
+	}
+	return byFile
+}
+
+// A normalDiagnostic is a diagnostic whose
+// position is relative to the test directory.
+type normalDiagnostic struct {
+	posn token.Position
+	*analysis.Diagnostic
+}
+
+func (d normalDiagnostic) String() string {
+	if d.Category != "" {
+		return fmt.Sprintf("%v: [%s] %s", d.posn, d.Category, d.Message)
+	}
+	return fmt.Sprintf("%v: %s", d.posn, d.Message)
+}
+
+// sortDiagnostics returns the diagnostics sorted by
+// normalized position, then category, then message.
+func sortDiagnostics(dir string, fset *token.FileSet, diagnostics []analysis.Diagnostic) []normalDiagnostic {
+	sorted := make([]normalDiagnostic, len(diagnostics))
+	for i := range diagnostics {
+		posn := fset.Position(diagnostics[i].Pos)
+		posn.Filename = sanitize(dir, posn.Filename)
+		sorted[i] = normalDiagnostic{posn, &diagnostics[i]}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		x, y := sorted[i], sorted[j]
+		if x.posn.Filename != y.posn.Filename {
+			return x.posn.Filename < y.posn.Filename
+		}
+		if x.posn.Line != y.posn.Line {
+			return x.posn.Line < y.posn.Line
+		}
+		if x.posn.Column != y.posn.Column {
+			return x.posn.Column < y.posn.Column
+		}
+		if x.Category != y.Category {
+			return x.Category < y.Category
+		}
+		return x.Message < y.Message
+	})
+	return sorted
+}
+
+// formatReport returns the report of a set of diagnostics, which
+// consists of their normalized form, each followed by the message of
+// each of its suggested fixes, and their edits:
+//
+//	a/a.go:4:2: [category] message
+//		fix: message of fix
+//			a/a.go:4:2-4:9: "new text"
+//
+// Identical entries, such as those from a package and its test
+// variant, appear only once.
+func formatReport(dir string, fset *token.FileSet, diagnostics []analysis.Diagnostic) string {
+	var buf strings.Builder
+	var prev string
+	for _, d := range sortDiagnostics(dir, fset, diagnostics) {
+		var entry strings.Builder
+		fmt.Fprintf(&entry, "%v\n", d)
+		for _, sf := range d.SuggestedFixes {
+			fmt.Fprintf(&entry, "\tfix: %s\n", sf.Message)
+			for _, edit := range sf.TextEdits {
+				start, end := fset.Position(edit.Pos), fset.Position(edit.End)
+				if !end.IsValid() {
+					end = start
+				}
+				fmt.Fprintf(&entry, "\t\t%s:%d:%d-%d:%d: %q\n",
+					sanitize(dir, start.Filename), start.Line, start.Column, end.Line, end.Column, edit.NewText)
+			}
+		}
+		if entry.String() != prev {
+			buf.WriteString(entry.String())
+			prev = entry.String()
+		}
+	}
+	return buf.String()
+}
+
+// checkReport compares the report of the diagnostics of each package
+// (see formatReport) with the golden file dir/path.report, where path
+// is the package path, or, if update is set, writes the golden file.
+// The generated main packages of tests have no report.
+func checkReport(t Testing, update bool, dir string, results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) {
+	paths, byPath, fsets := diagnosticsByPackage(results, filter)
+	for _, path := range paths {
+		got := formatReport(dir, fsets[path], byPath[path])
+		golden := filepath.Join(dir, filepath.FromSlash(path)+".report")
+		checkGolden(t, update, golden, "report for package "+path, got)
+	}
+}
+
+// checkJSONGolden compares the JSON form of the diagnostics of each
+// package (see formatJSON) with the golden file dir/path.findings.json,
+// where path is the package path, or, if update is set, writes the
+// golden file. The generated main packages of tests have none.
+func checkJSONGolden(t Testing, update bool, dir string, results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) {
+	paths, byPath, fsets := diagnosticsByPackage(results, filter)
+	for _, path := range paths {
+		got, err := formatJSON(dir, fsets[path], byPath[path])
+		if err != nil {
+			t.Errorf("encoding findings of package %s: %v", path, err)
+			continue
+		}
+		golden := filepath.Join(dir, filepath.FromSlash(path)+".findings.json")
+		checkGolden(t, update, golden, "JSON form of the findings of package "+path, got)
+	}
+}
+
+// checkResultGolden compares the result of the analyzer for each
+// package, formatted by format, or by %+v if format is nil, with the
+// golden file dir/path.result.golden, where path is the package path,
+// or, if update is set, writes the golden file. Test variants and the
+// generated main packages of tests, and packages whose analysis
+// failed, are skipped.
+func checkResultGolden(t Testing, update bool, dir string, results []*Result, format func(interface{}) []byte) {
+	for _, result := range results {
+		pkg := result.Package
+		if result.Err != nil || strings.Contains(pkg.ID, " [") || strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		var got string
+		if format != nil {
+			got = string(format(result.Result))
+		} else {
+			got = fmt.Sprintf("%+v\n", result.Result)
+		}
+		golden := filepath.Join(dir, filepath.FromSlash(pkg.PkgPath)+".result.golden")
+		checkGolden(t, update, golden, "result for package "+pkg.PkgPath, got)
+	}
+}
+
+// diagnosticsByPackage returns the paths of the packages of the
+// results, in order, and the diagnostics and FileSet of each,
+// combining the diagnostics of a package with those of its test
+// variant, if any. The generated main packages of tests are omitted.
+func diagnosticsByPackage(results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) (paths []string, byPath map[string][]analysis.Diagnostic, fsets map[string]*token.FileSet) {
+	byPath = make(map[string][]analysis.Diagnostic)
+	fsets = make(map[string]*token.FileSet)
+	for _, result := range results {
+		pkg := result.Package
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		if _, ok := fsets[pkg.PkgPath]; !ok {
+			paths = append(paths, pkg.PkgPath)
+			fsets[pkg.PkgPath] = pkg.Fset
+		}
+		byPath[pkg.PkgPath] = append(byPath[pkg.PkgPath], filter(result.Diagnostics)...)
+	}
+	return paths, byPath, fsets
+}
+
+// checkGolden compares got, described by what, with the contents of
+// the golden file, or, if update is set, writes the golden file.
+func checkGolden(t Testing, update bool, golden, what, got string) {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0777); err != nil {
+			t.Errorf("%v", err)
+		} else if err := ioutil.WriteFile(golden, []byte(got), 0666); err != nil {
+			t.Errorf("%v", err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Errorf("reading %s: %v", what, err)
+		return
+	}
+	if want := string(data); want != got {
+		d, err := myers.ComputeEdits("", want, got)
+		if err != nil {
+			t.Errorf("failed to compute edits: %s", err)
+		}
+		t.Errorf("%s differs from golden file:\n%s", what, diff.ToUnified(golden, "actual", want, d))
+	}
+}
+
+// formatJSON returns the diagnostics as an indented JSON array of
+// objects in the form of the -json output of drivers, sorted as by
+// NormalizeFindings, omitting duplicates such as those from a package
+// and its test variant.
+func formatJSON(dir string, fset *token.FileSet, diagnostics []analysis.Diagnostic) (string, error) {
+	list := []jsonDiagnostic{} // not null, if empty
+	for _, d := range sortDiagnostics(dir, fset, diagnostics) {
+		jd := jsonDiagnostic{
+			Category: d.Category,
+			Posn:     d.posn.String(),
+			Message:  d.Message,
+			URL:      d.URL,
+		}
+		if n := len(list); n > 0 && list[n-1] == jd {
+			continue
+		}
+		list = append(list, jd)
+	}
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// writeSnapshot writes to w the normalized form (see NormalizeFindings)
+// of the diagnostics of all the results, one per line, omitting
+// duplicates such as those from a package and its test variant.
+func writeSnapshot(t Testing, w io.Writer, dir string, results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) {
+	if len(results) == 0 {
+		return
+	}
+	if _, err := io.WriteString(w, formatSnapshot(dir, results, filter)); err != nil {
+		t.Errorf("writing snapshot: %v", err)
+	}
+}
+
+// checkSnapshotFile compares the snapshot of the diagnostics of all the
+// packages (see formatSnapshot) with the snapshot file, which is
+// relative to dir unless absolute, or, if update is set or the file
+// does not exist, writes the file.
+func checkSnapshotFile(t Testing, update bool, file, dir string, results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	if !update {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			logf(t, "creating snapshot file %s", file)
+			update = true
+		}
+	}
+	checkGolden(t, update, file, "snapshot of findings", formatSnapshot(dir, results, filter))
+}
+
+// formatSnapshot returns the diagnostics of all the packages in the
+// form of NormalizeFindings, one per line, omitting duplicates such as
+// those from a package and its test variant.
+func formatSnapshot(dir string, results []*Result, filter func([]analysis.Diagnostic) []analysis.Diagnostic) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var all []analysis.Diagnostic
+	for _, result := range results {
+		all = append(all, filter(result.Diagnostics)...)
+	}
+	var buf strings.Builder
+	var prev string
+	for _, line := range NormalizeFindings(dir, results[0].Package.Fset, all) {
+		if line != prev {
+			fmt.Fprintln(&buf, line)
+			prev = line
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,399 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"bytes"
+	"go/ast"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// removeprint reports each call of print, in the "print"
+// category, with a suggested fix to remove it.
+var removeprint = &analysis.Analyzer{
+	Name: "removeprint",
+	Doc:  "report calls of print",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "print" {
+						pass.Report(analysis.Diagnostic{
+							Pos:      call.Pos(),
+							Category: "print",
+							Message:  "call of print",
+							SuggestedFixes: []analysis.SuggestedFix{{
+								Message:   "Remove call",
+								TextEdits: []analysis.TextEdit{{Pos: call.Pos(), End: call.End()}},
+							}},
+						})
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func TestGoldenReport(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print() // want "call of print"
+	print() // want "call of print"
+}
+`,
+		"a/a_test.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Create the report.
+	analysistest.NewRunner(analysistest.WithGoldenReport(true)).Run(t, dir, removeprint, "a")
+
+	golden := filepath.Join(dir, "a.report")
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `a/a.go:4:2: [print] call of print
+	fix: Remove call
+		a/a.go:4:2-4:9: ""
+a/a.go:5:2: [print] call of print
+	fix: Remove call
+		a/a.go:5:2-5:9: ""
+a/a_test.go:4:2: [print] call of print
+	fix: Remove call
+		a/a_test.go:4:2-4:9: ""
+`
+	if got := string(data); got != want {
+		t.Errorf("got report:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Check it.
+	analysistest.NewRunner(analysistest.WithGoldenReport(false)).Run(t, dir, removeprint, "a")
+
+	// Check a stale report.
+	stale := strings.Replace(want, "Remove call", "Delete call", 1)
+	if err := ioutil.WriteFile(golden, []byte(stale), 0666); err != nil {
+		t.Fatal(err)
+	}
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithGoldenReport(false)).Run(t2, dir, removeprint, "a")
+	if len(t2.errors) != 1 || !strings.Contains(t2.errors[0], "report for package a differs from golden file") {
+		t.Errorf("got errors %q, want one report difference", t2.errors)
+	}
+}
+
+func TestJSONGolden(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+	print()
+}
+`,
+		"a/a_test.go": `package a
+
+func g() {
+	print()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Create the golden file, without 'want' comments.
+	analysistest.NewRunner(analysistest.WithJSONGolden(true)).Run(t, dir, removeprint, "a")
+
+	golden := filepath.Join(dir, "a.findings.json")
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+	{
+		"category": "print",
+		"posn": "a/a.go:4:2",
+		"message": "call of print"
+	},
+	{
+		"category": "print",
+		"posn": "a/a.go:5:2",
+		"message": "call of print"
+	},
+	{
+		"category": "print",
+		"posn": "a/a_test.go:4:2",
+		"message": "call of print"
+	}
+]
+`
+	if got := string(data); got != want {
+		t.Errorf("got golden file:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Check it.
+	analysistest.NewRunner(analysistest.WithJSONGolden(false)).Run(t, dir, removeprint, "a")
+
+	// Check a stale golden file.
+	stale := strings.Replace(want, "a/a.go:5:2", "a/a.go:6:2", 1)
+	if err := ioutil.WriteFile(golden, []byte(stale), 0666); err != nil {
+		t.Fatal(err)
+	}
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithJSONGolden(false)).Run(t2, dir, removeprint, "a")
+	if len(t2.errors) != 1 || !strings.Contains(t2.errors[0], "JSON form of the findings of package a differs from golden file") {
+		t.Errorf("got errors %q, want one difference", t2.errors)
+	}
+}
+
+// funcnames returns the names of the functions declared
+// in the package, in order of declaration, as its result.
+var funcnames = &analysis.Analyzer{
+	Name:       "funcnames",
+	Doc:        "list the declared functions",
+	ResultType: reflect.TypeOf([]string(nil)),
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		var names []string
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok {
+					names = append(names, decl.Name.Name)
+				}
+			}
+		}
+		return names, nil
+	},
+}
+
+func TestResultGolden(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {}
+
+func g() {}
+`,
+		"a/a_test.go": `package a
+
+func h() {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Create the golden file.
+	analysistest.NewRunner(analysistest.WithResultGolden(nil, true)).Run(t, dir, funcnames, "a")
+
+	golden := filepath.Join(dir, "a.result.golden")
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "[f g]\n"; got != want {
+		t.Errorf("got golden file %q, want %q", got, want)
+	}
+
+	// Check it.
+	analysistest.NewRunner(analysistest.WithResultGolden(nil, false)).Run(t, dir, funcnames, "a")
+
+	// Check it with a format that differs.
+	lines := func(result interface{}) []byte {
+		return []byte(strings.Join(result.([]string), "\n") + "\n")
+	}
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithResultGolden(lines, false)).Run(t2, dir, funcnames, "a")
+	if len(t2.errors) != 1 || !strings.Contains(t2.errors[0], "result for package a differs from golden file") {
+		t.Errorf("got errors %q, want one difference", t2.errors)
+	}
+}
+
+func TestNormalizeFindings(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	for _, result := range analysistest.Run(t, dir, printcall, "a") {
+		got = append(got, analysistest.NormalizeFindings(dir, result.Pass.Fset, result.Diagnostics)...)
+	}
+	want := []string{
+		"a/a.go:4:2: call of println",
+		"a/a.go:5:2: call of print",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFindingsByFile(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+	print()   // want "call of print"
+}
+`,
+		"a/b.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	results := analysistest.Run(t, dir, printcall, "a")
+	got := make(map[string][]string)
+	for file, diagnostics := range analysistest.FindingsByFile(dir, results[0]) {
+		for _, d := range diagnostics {
+			got[file] = append(got[file], d.Message)
+		}
+	}
+	want := map[string][]string{
+		"a/a.go": {"call of println", "call of print"},
+		"a/b.go": {"call of print"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+}
+`,
+		"a/a_test.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+		"b/b.go": `package b
+
+func h() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var buf bytes.Buffer
+	analysistest.NewRunner(analysistest.WithSnapshot(&buf)).Run(t, dir, printcall, "a", "b")
+	want := `a/a.go:4:2: call of println
+a/a_test.go:4:2: call of print
+b/b.go:4:2: call of print
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got snapshot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call of println"
+	print()   // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The first run creates the snapshot.
+	analysistest.NewRunner(analysistest.WithSnapshotFile("printcall.snapshot", false)).Run(t, dir, printcall, "a")
+	file := filepath.Join(dir, "printcall.snapshot")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `a/a.go:4:2: call of println
+a/a.go:5:2: call of print
+`
+	if got := string(data); got != want {
+		t.Errorf("got snapshot:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A later run compares with it.
+	analysistest.NewRunner(analysistest.WithSnapshotFile(file, false)).Run(t, dir, printcall, "a")
+
+	stale := strings.Replace(want, "a/a.go:5:2", "a/a.go:6:2", 1)
+	if err := ioutil.WriteFile(file, []byte(stale), 0666); err != nil {
+		t.Fatal(err)
+	}
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithSnapshotFile(file, false)).Run(t2, dir, printcall, "a")
+	if len(t2.errors) != 1 || !strings.Contains(t2.errors[0], "snapshot of findings differs from golden file") {
+		t.Errorf("got errors %q, want one difference", t2.errors)
+	}
+
+	// Updating accepts the change.
+	analysistest.NewRunner(analysistest.WithSnapshotFile(file, true)).Run(t, dir, printcall, "a")
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != want {
+		t.Errorf("got updated snapshot %q (%v), want %q", data, err, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// This file defines the reading and writing of sidecar files, which
+// hold the expectations of source files that cannot be annotated with
+// 'want' comments; see Run.
+
+// sidecarSuffix is the suffix of the name of a sidecar file.
+const sidecarSuffix = ".want"
+
+// readSidecar calls process for each entry of the sidecar file of the
+// source file filename, if it has one, as if it were a comment that
+// began with keyword. The name passed to process is the sanitized name
+// of the source file.
+func readSidecar(t Testing, gopath, filename, keyword string, process func(filename string, linenum int, text string)) {
+	data, err := ioutil.ReadFile(filename + sidecarSuffix)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		t.Errorf("can't read expectations from sidecar file: %v", err)
+		return
+	}
+	name := sanitize(gopath, filename)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		linenum := 0
+		colon := strings.Index(line, ":")
+		if colon >= 0 {
+			linenum, _ = strconv.Atoi(line[:colon])
+		}
+		if linenum < 1 {
+			t.Errorf("%s%s:%d: invalid entry %q, want 'line: expectations'", name, sidecarSuffix, i+1, line)
+			continue
+		}
+		process(name, linenum, keyword+line[colon+1:])
+	}
+}
+
+// writeSidecar replaces the sidecar file of the source file filename,
+// if it has one, by one that expects exactly the given diagnostics of
+// the file, each matched by a pattern that matches only its message.
+func writeSidecar(t Testing, pass *analysis.Pass, filename string, diagnostics []analysis.Diagnostic) {
+	if _, err := os.Stat(filename + sidecarSuffix); err != nil {
+		return // no sidecar
+	}
+
+	patterns := make(map[int][]string)
+	for _, d := range diagnostics {
+		posn := pass.Fset.Position(d.Pos)
+		if posn.Filename == filename {
+			patterns[posn.Line] = append(patterns[posn.Line], exactPattern(d.Message))
+		}
+	}
+	var lines []int
+	for line := range patterns {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		fmt.Fprintf(&buf, "%d: %s\n", line, strings.Join(patterns[line], " "))
+	}
+	if err := ioutil.WriteFile(filename+sidecarSuffix, buf.Bytes(), 0666); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// exactPattern returns a string literal for a pattern
+// that matches only the message.
+func exactPattern(message string) string {
+	return quotePattern("^" + regexp.QuoteMeta(message) + "$")
+}
+
+// quotePattern returns a string literal for the pattern, preferring
+// the raw form, which needs no escapes.
+func quotePattern(pattern string) string {
+	if strconv.CanBackquote(pattern) {
+		return "`" + pattern + "`"
+	}
+	return strconv.Quote(pattern)
+}
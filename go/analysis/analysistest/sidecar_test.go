@@ -0,0 +1,76 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestSidecar(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `// Code generated by hand. DO NOT EDIT.
+
+package a
+
+func f() {
+	print()
+	println(); print()
+}
+`,
+		"a/a.go.want": `6: "call of print"
+
+7: "call of println" "call of print$"
+`,
+		"a/b.go": `package a
+
+func g() {
+	print() // want "call of print"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	analysistest.Run(t, dir, printcall, "a")
+
+	// Errors in sidecar files are reported.
+	sidecar := filepath.Join(dir, "src/a/a.go.want")
+	if err := ioutil.WriteFile(sidecar, []byte("6 \"call of print\"\n7: \"call of println\"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) })
+	analysistest.Run(t2, dir, printcall, "a")
+	want := []string{
+		`a/a.go.want:1: invalid entry "6 \"call of print\"", want 'line: expectations'`,
+		`a/a.go:6:2: unexpected diagnostic: call of print`,
+		`a/a.go:7:13: unexpected diagnostic: call of print`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// WithSidecarUpdate regenerates the sidecar file.
+	analysistest.NewRunner(analysistest.WithSidecarUpdate(true)).Run(t, dir, printcall, "a")
+	data, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "6: `^call of print$`\n7: `^call of println$` `^call of print$`\n"; got != want {
+		t.Errorf("updated sidecar file is:\n%s\nwant:\n%s", got, want)
+	}
+	analysistest.Run(t, dir, printcall, "a")
+}
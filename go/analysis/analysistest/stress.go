@@ -0,0 +1,57 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// checkStress applies the analyzer to the packages r.cfg.stress more
+// times, concurrently, and reports each analysis whose outcome differs
+// from that of results, the outcome of the first analysis.
+func (r *Runner) checkStress(t Testing, dir string, a *analysis.Analyzer, pkgs []*packages.Package, results []*Result) {
+	want := make(map[string]string)
+	for _, result := range results {
+		want[result.Package.ID] = outcome(dir, result)
+	}
+
+	// Report duplicate facts only once, for the first analysis.
+	r2 := &Runner{cfg: r.cfg}
+	r2.cfg.noDupFacts = false
+
+	runs := make([][]*Result, r.cfg.stress)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runs[i] = r2.testAnalyzer(t, dir, a, pkgs)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, run := range runs {
+		for _, result := range run {
+			id := result.Package.ID
+			if got := outcome(dir, result); got != want[id] {
+				t.Errorf("concurrent analysis %d of %s differs from the first:\ngot:\n%s\nwant:\n%s", i+1, id, got, want[id])
+			}
+		}
+	}
+}
+
+// outcome returns a textual form of the outcome of an analysis: its
+// error, if any, or its diagnostics, in the form of NormalizeFindings.
+func outcome(dir string, result *Result) string {
+	if result.Err != nil {
+		return fmt.Sprintf("error: %v", result.Err)
+	}
+	return strings.Join(NormalizeFindings(dir, result.Pass.Fset, result.Diagnostics), "\n")
+}
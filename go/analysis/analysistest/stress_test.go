@@ -0,0 +1,68 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"go/ast"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestStress(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println() // want "call (1 )?of println"
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// counter numbers the calls of println it reports across all
+	// analyses, so its diagnostics depend on what ran before.
+	var calls int32
+	counter := &analysis.Analyzer{
+		Name: "counter",
+		Doc:  "number calls of println",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "println" {
+							pass.Reportf(call.Pos(), "call %d of println", atomic.AddInt32(&calls, 1))
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+
+	t2 := new(logger)
+	analysistest.NewRunner(analysistest.WithStress(3)).Run(t2, dir, counter, "a")
+	if len(t2.errors) != 3 {
+		t.Fatalf("got %d errors, want 3:\n%s", len(t2.errors), strings.Join(t2.errors, "\n"))
+	}
+	for _, err := range t2.errors {
+		if !strings.Contains(err, "differs from the first") || !strings.Contains(err, "want:\na/a.go:4:2: call 1 of println") {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+
+	// An analyzer without shared state passes.
+	analysistest.NewRunner(analysistest.WithStress(3)).Run(t, dir, printcall, "a")
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// writeWants inserts a 'want' comment at the end of each line of the
+// file f on which diagnostics are reported, if it has none, and passes
+// each inserted comment to process, as the comments of the file have
+// already been parsed; see WithWantUpdate.
+func writeWants(t Testing, cfg *config, gopath string, pass *analysis.Pass, f *ast.File, diagnostics []analysis.Diagnostic, process func(filename string, linenum int, text string)) {
+	tf := pass.Fset.File(f.Pos())
+	keyword := cfg.wantKeyword(pass)
+
+	// Find the lines that are the subject of a 'want' comment, and
+	// those that end within a multi-line literal or comment.
+	hasWant := make(map[int]bool)
+	spanned := make(map[int]bool)
+	span := func(n ast.Node) {
+		for line := tf.Line(n.Pos()); line < tf.Line(n.End()); line++ {
+			spanned[line] = true
+		}
+	}
+	for _, cgroup := range f.Comments {
+		for _, c := range cgroup.List {
+			// As in check, but only to find the line of each comment.
+			text := strings.TrimPrefix(c.Text, "//")
+			if text == c.Text {
+				text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+			}
+			if i := strings.Index(text, "// "+keyword); i >= 0 {
+				text = text[i+len("// "):]
+			}
+			if rest := strings.TrimPrefix(strings.TrimSpace(text), keyword); rest != strings.TrimSpace(text) {
+				lineDelta, _, _ := parseExpectations(cfg, rest)
+				hasWant[tf.Line(c.Pos())+lineDelta] = true
+			}
+			span(c)
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			span(lit)
+		}
+		return true
+	})
+
+	// Collect the diagnostics of each unannotated line, in order.
+	byLine := make(map[int][]analysis.Diagnostic)
+	for _, d := range diagnostics {
+		if pass.Fset.File(d.Pos) != tf {
+			continue
+		}
+		if line := tf.Line(d.Pos); !hasWant[line] {
+			byLine[line] = append(byLine[line], d)
+		}
+	}
+	if len(byLine) == 0 {
+		return
+	}
+	var lines []int
+	for line := range byLine {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	content, err := ioutil.ReadFile(tf.Name())
+	if err != nil {
+		t.Errorf("can't add 'want' comments: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	last := 0 // offset in content of the first byte not yet copied
+	for _, line := range lines {
+		posn := pass.Fset.Position(tf.LineStart(line))
+		posn.Filename = sanitize(gopath, posn.Filename)
+		if spanned[line] {
+			t.Errorf("%s:%d: can't add a 'want' comment to a line that ends within a string literal or comment", posn.Filename, posn.Line)
+			continue
+		}
+		ds := byLine[line]
+		sort.SliceStable(ds, func(i, j int) bool { return ds[i].Pos < ds[j].Pos })
+		var patterns []string
+		for _, d := range ds {
+			patterns = append(patterns, exactPattern(d.Message))
+		}
+		comment := keyword + " " + strings.Join(patterns, " ")
+
+		end := tf.Offset(tf.LineStart(line))
+		if i := bytes.IndexByte(content[end:], '\n'); i >= 0 {
+			end += i
+		} else {
+			end = len(content)
+		}
+		if end > 0 && content[end-1] == '\r' {
+			end--
+		}
+		buf.Write(bytes.TrimRight(content[last:end], " \t"))
+		buf.WriteString(" // " + comment)
+		last = end
+		process(posn.Filename, posn.Line, comment)
+	}
+	buf.Write(content[last:])
+	if !bytes.Equal(buf.Bytes(), content) {
+		if err := ioutil.WriteFile(tf.Name(), buf.Bytes(), 0666); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+}
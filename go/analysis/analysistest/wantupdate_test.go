@@ -0,0 +1,60 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysistest_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/internal/testenv"
+)
+
+func TestWantUpdate(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	print()
+	println(); print()	
+	print() // want "call of print"
+	// want +1 "call of println"
+	println()
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	filename := filepath.Join(dir, "src/a/a.go")
+	want := "package a\n" +
+		"\n" +
+		"func f() {\n" +
+		"\tprint() // want `^call of print$`\n" +
+		"\tprintln(); print() // want `^call of println$` `^call of print$`\n" +
+		"\tprint() // want \"call of print\"\n" +
+		"\t// want +1 \"call of println\"\n" +
+		"\tprintln()\n" +
+		"}\n"
+
+	// The update adds the missing comments, and the same run passes.
+	// Repeating it changes nothing.
+	for i := 0; i < 2; i++ {
+		analysistest.NewRunner(analysistest.WithWantUpdate(true)).Run(t, dir, printcall, "a")
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != want {
+			t.Errorf("run %d: updated file is:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+	analysistest.Run(t, dir, printcall, "a")
+}
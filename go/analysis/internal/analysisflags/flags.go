@@ -356,6 +356,7 @@ func (tree JSONTree) Add(fset *token.FileSet, id, name string, diags []analysis.
 			Category string `json:"category,omitempty"`
 			Posn     string `json:"posn"`
 			Message  string `json:"message"`
+			URL      string `json:"url,omitempty"`
 		}
 		var diagnostics []jsonDiagnostic
 		// TODO(matloob): Should the JSON diagnostics contain ranges?
@@ -365,6 +366,7 @@ func (tree JSONTree) Add(fset *token.FileSet, id, name string, diags []analysis.
 				Category: f.Category,
 				Posn:     fset.Position(f.Pos).String(),
 				Message:  f.Message,
+				URL:      f.URL,
 			})
 		}
 		v = diagnostics
@@ -31,8 +31,10 @@ import (
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/internal/analysisflags"
+	"golang.org/x/tools/go/ast/inspector"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/internal/analysisinternal"
+	"golang.org/x/tools/internal/inspectorinternal"
 	"golang.org/x/tools/internal/span"
 )
 
@@ -134,7 +136,7 @@ func Run(args []string, analyzers []*analysis.Analyzer) (exitcode int) {
 	}
 
 	// Print the results.
-	roots := analyze(initial, analyzers)
+	roots := analyze(initial, analyzers, new(TestOptions))
 
 	if Fix {
 		applyFixes(roots)
@@ -175,8 +177,57 @@ func load(patterns []string, allSyntax bool) ([]*packages.Package, error) {
 //
 // This entry point is used only by analysistest.
 func TestAnalyzer(a *analysis.Analyzer, pkgs []*packages.Package) []*TestAnalyzerResult {
+	return TestAnalyzerWithOptions(a, pkgs, nil)
+}
+
+// TestOptions holds the options of TestAnalyzerWithOptions.
+type TestOptions struct {
+	// RunDespiteErrors causes the analysis, and those it requires,
+	// to be applied even to packages that contain parse or type
+	// errors, as if each analyzer set RunDespiteErrors.
+	RunDespiteErrors bool
+
+	// ImportFacts, if non-nil, is called before an analyzer is
+	// applied to a dependency of the initial packages. If it returns
+	// ok, the analyzer is not applied to the dependency; instead, the
+	// facts of the dependency are those returned, as if the analyzer
+	// had exported them.
+	ImportFacts func(a *analysis.Analyzer, pkg *types.Package) (objectFacts []analysis.ObjectFact, packageFacts []analysis.PackageFact, ok bool)
+
+	// RecoverPanics causes a panic in an analyzer to be reported as
+	// the error of its analysis of the package, rather than crashing.
+	RecoverPanics bool
+
+	// MaxParallel, if positive, is the maximum number of analyzers
+	// that may be applied to packages at once.
+	MaxParallel int
+
+	// Trace, if non-nil, is called just before an analyzer is
+	// applied to a package, and the function it returns is called
+	// when the analyzer returns. It may be called concurrently.
+	Trace func(a *analysis.Analyzer, pkg *packages.Package) func()
+
+	// Traverse, if non-nil, is called each time the analyzer, applied
+	// to one of the packages, traverses an inspector.Inspector that it
+	// requires, such as the result of the inspect pass, with the number
+	// of nodes of the package. It may be called concurrently.
+	Traverse func(pkg *packages.Package, nodes int)
+
+	// ExportFact, if non-nil, is called each time an analyzer
+	// exports a fact, with a nil obj for a package fact, even if
+	// the fact replaces one previously exported. It may be called
+	// concurrently.
+	ExportFact func(pass *analysis.Pass, obj types.Object, fact analysis.Fact)
+}
+
+// TestAnalyzerWithOptions is like TestAnalyzer, but it accepts
+// options. A nil *TestOptions is equivalent to the zero value.
+func TestAnalyzerWithOptions(a *analysis.Analyzer, pkgs []*packages.Package, opts *TestOptions) []*TestAnalyzerResult {
+	if opts == nil {
+		opts = new(TestOptions)
+	}
 	var results []*TestAnalyzerResult
-	for _, act := range analyze(pkgs, []*analysis.Analyzer{a}) {
+	for _, act := range analyze(pkgs, []*analysis.Analyzer{a}, opts) {
 		facts := make(map[types.Object][]analysis.Fact)
 		for key, fact := range act.objectFacts {
 			if key.obj.Pkg() == act.pass.Pkg {
@@ -189,20 +240,23 @@ func TestAnalyzer(a *analysis.Analyzer, pkgs []*packages.Package) []*TestAnalyze
 			}
 		}
 
-		results = append(results, &TestAnalyzerResult{act.pass, act.diagnostics, facts, act.result, act.err})
+		results = append(results, &TestAnalyzerResult{act.pkg, act.pass, act.diagnostics, facts, act.result, act.err, act.duration})
 	}
 	return results
 }
 
 type TestAnalyzerResult struct {
+	Package     *packages.Package
 	Pass        *analysis.Pass
 	Diagnostics []analysis.Diagnostic
 	Facts       map[types.Object][]analysis.Fact
 	Result      interface{}
 	Err         error
+	Duration    time.Duration // time spent in the analysis of this package, excluding its dependencies
 }
 
-func analyze(pkgs []*packages.Package, analyzers []*analysis.Analyzer) []*action {
+// analyze applies the analyzers to the packages, as modified by opts.
+func analyze(pkgs []*packages.Package, analyzers []*analysis.Analyzer, opts *TestOptions) []*action {
 	// Construct the action graph.
 	if dbg('v') {
 		log.Printf("building graph of analysis passes")
@@ -217,12 +271,17 @@ func analyze(pkgs []*packages.Package, analyzers []*analysis.Analyzer) []*action
 	}
 	actions := make(map[key]*action)
 
+	var sem chan struct{} // if non-nil, limits the number of running actions
+	if opts.MaxParallel > 0 {
+		sem = make(chan struct{}, opts.MaxParallel)
+	}
+
 	var mkAction func(a *analysis.Analyzer, pkg *packages.Package) *action
 	mkAction = func(a *analysis.Analyzer, pkg *packages.Package) *action {
 		k := key{a, pkg}
 		act, ok := actions[k]
 		if !ok {
-			act = &action{a: a, pkg: pkg}
+			act = &action{a: a, pkg: pkg, opts: opts, sem: sem}
 
 			// Add a dependency on each required analyzers.
 			for _, req := range a.Requires {
@@ -542,6 +601,9 @@ type action struct {
 	diagnostics  []analysis.Diagnostic
 	err          error
 	duration     time.Duration
+
+	opts *TestOptions
+	sem  chan struct{} // if non-nil, held while the analyzer runs
 }
 
 type objectFactKey struct {
@@ -579,9 +641,32 @@ func execAll(actions []*action) {
 func (act *action) exec() { act.once.Do(act.execOnce) }
 
 func (act *action) execOnce() {
+	// Use the supplied facts of a dependency, if any.
+	if !act.isroot && act.opts.ImportFacts != nil {
+		if objectFacts, packageFacts, ok := act.opts.ImportFacts(act.a, act.pkg.Types); ok {
+			act.objectFacts = make(map[objectFactKey]analysis.Fact)
+			act.packageFacts = make(map[packageFactKey]analysis.Fact)
+			for _, f := range objectFacts {
+				act.objectFacts[objectFactKey{f.Object, reflect.TypeOf(f.Fact)}] = f.Fact
+			}
+			for _, f := range packageFacts {
+				act.packageFacts[packageFactKey{f.Package, reflect.TypeOf(f.Fact)}] = f.Fact
+			}
+			return
+		}
+	}
+
 	// Analyze dependencies.
 	execAll(act.deps)
 
+	// Wait for a turn to run, if parallelism is limited. The
+	// dependencies have finished, so no action holds a turn
+	// while it waits for another.
+	if act.sem != nil {
+		act.sem <- struct{}{}
+		defer func() { <-act.sem }()
+	}
+
 	// TODO(adonovan): uncomment this during profiling.
 	// It won't build pre-go1.11 but conditional compilation
 	// using build tags isn't warranted.
@@ -591,14 +676,14 @@ func (act *action) execOnce() {
 	// defer task.End()
 
 	// Record time spent in this node but not its dependencies.
+	// It is recorded unconditionally, for the Duration of a
+	// TestAnalyzerResult; -debug=t merely prints it.
 	// In parallel mode, due to GC/scheduler contention, the
 	// time is 5x higher than in sequential mode, even with a
 	// semaphore limiting the number of threads here.
-	// So use -debug=tp.
-	if dbg('t') {
-		t0 := time.Now()
-		defer func() { act.duration = time.Since(t0) }()
-	}
+	// So, for the profile printed by -debug=t, use -debug=tp.
+	t0 := time.Now()
+	defer func() { act.duration = time.Since(t0) }()
 
 	// Report an error if any dependency failed.
 	var failed []string
@@ -624,6 +709,12 @@ func (act *action) execOnce() {
 			// in-memory outputs of prerequisite analyzers
 			// become inputs to this analysis pass.
 			inputs[dep.a] = dep.result
+			if in, ok := dep.result.(*inspector.Inspector); ok && act.isroot && act.opts.Traverse != nil {
+				// Count the traversals of the analyzer with its
+				// own copy of the inspector, which is shared.
+				pkg := act.pkg
+				inputs[dep.a] = inspectorinternal.Instrument(in, func(nodes int) { act.opts.Traverse(pkg, nodes) })
+			}
 
 		} else if dep.a == act.a { // (always true)
 			// Same analysis, different package (vertical edge):
@@ -685,9 +776,19 @@ func (act *action) execOnce() {
 	analysisinternal.SetTypeErrors(pass, errors)
 
 	var err error
-	if act.pkg.IllTyped && !pass.Analyzer.RunDespiteErrors {
+	if act.pkg.IllTyped && !pass.Analyzer.RunDespiteErrors && !act.opts.RunDespiteErrors {
 		err = fmt.Errorf("analysis skipped due to errors in package")
 	} else {
+		if act.opts.Trace != nil {
+			defer act.opts.Trace(act.a, act.pkg)()
+		}
+		if act.opts.RecoverPanics {
+			defer func() {
+				if x := recover(); x != nil {
+					act.err = fmt.Errorf("analyzer panicked: %v", x)
+				}
+			}()
+		}
 		act.result, err = pass.Analyzer.Run(pass)
 		if err == nil {
 			if got, want := reflect.TypeOf(act.result), pass.Analyzer.ResultType; got != want {
@@ -840,6 +941,10 @@ func (act *action) exportObjectFact(obj types.Object, fact analysis.Fact) {
 			act.a, act.pkg, obj, fact)
 	}
 
+	if act.opts.ExportFact != nil {
+		act.opts.ExportFact(act.pass, obj, fact)
+	}
+
 	key := objectFactKey{obj, factType(fact)}
 	act.objectFacts[key] = fact // clobber any existing entry
 	if dbg('f') {
@@ -879,6 +984,10 @@ func (act *action) exportPackageFact(fact analysis.Fact) {
 		log.Panicf("%s: Pass.ExportPackageFact(%T) called after Run", act, fact)
 	}
 
+	if act.opts.ExportFact != nil {
+		act.opts.ExportFact(act.pass, nil, fact)
+	}
+
 	key := packageFactKey{act.pass.Pkg, factType(fact)}
 	act.packageFacts[key] = fact // clobber any existing entry
 	if dbg('f') {
@@ -150,6 +150,9 @@ type Config struct {
 	// modFlag will be used for -modfile in go command invocations.
 	modFlag string
 
+	// driver, if non-nil, is used in place of the default driver.
+	driver driver
+
 	// Fset provides source position information for syntax trees and types.
 	// If Fset is nil, Load will use a new fileset, but preserve Fset's value.
 	Fset *token.FileSet
@@ -237,7 +240,11 @@ type driverResponse struct {
 // provided for convenient display of all errors.
 func Load(cfg *Config, patterns ...string) ([]*Package, error) {
 	l := newLoader(cfg)
-	response, err := defaultDriver(&l.Config, patterns...)
+	driver := l.Config.driver
+	if driver == nil {
+		driver = defaultDriver
+	}
+	response, err := driver(&l.Config, patterns...)
 	if err != nil {
 		return nil, err
 	}
@@ -384,6 +391,19 @@ func init() {
 	packagesinternal.SetModFlag = func(config interface{}, value string) {
 		config.(*Config).modFlag = value
 	}
+	packagesinternal.SetDriver = func(config interface{}, f func(patterns ...string) ([]byte, error)) {
+		config.(*Config).driver = func(cfg *Config, patterns ...string) (*driverResponse, error) {
+			data, err := f(patterns...)
+			if err != nil {
+				return nil, err
+			}
+			var response driverResponse
+			if err := json.Unmarshal(data, &response); err != nil {
+				return nil, fmt.Errorf("JSON unmarshaling driver response: %v", err)
+			}
+			return &response, nil
+		}
+	}
 	packagesinternal.TypecheckCgo = int(typecheckCgo)
 }
 
@@ -477,6 +497,7 @@ func (p *Package) UnmarshalJSON(b []byte) error {
 		GoFiles:         flat.GoFiles,
 		CompiledGoFiles: flat.CompiledGoFiles,
 		OtherFiles:      flat.OtherFiles,
+		IgnoredFiles:    flat.IgnoredFiles,
 		ExportFile:      flat.ExportFile,
 	}
 	if len(flat.Imports) > 0 {
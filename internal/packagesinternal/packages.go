@@ -26,3 +26,8 @@ var TypecheckCgo int
 
 var SetModFlag = func(config interface{}, value string) {}
 var SetModFile = func(config interface{}, value string) {}
+
+// SetDriver sets the driver of a *packages.Config to a function that
+// returns, in JSON form, the response of a driver to a query of the
+// patterns, in the format used by GOPACKAGESDRIVER programs.
+var SetDriver = func(config interface{}, driver func(patterns ...string) ([]byte, error)) {}